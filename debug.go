@@ -0,0 +1,7 @@
+// +build xstatsdebug
+
+package xstats
+
+// debugBuild keeps closed instances out of the pool and captures stacks of
+// observations made after close.
+const debugBuild = true
@@ -0,0 +1,148 @@
+package dogstatsd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/xstats"
+	"github.com/rs/xstats/udp"
+)
+
+const (
+	// defaultUDPMaxPacketLen keeps UDP packets within a standard 1500 bytes MTU.
+	defaultUDPMaxPacketLen = 1432
+	// defaultUnixgramMaxPacketLen is the datagram size the Datadog agent reads
+	// on its unix datagram socket.
+	defaultUnixgramMaxPacketLen = 8192
+	// defaultUnixMaxPacketLen is used for stream sockets, which have no
+	// datagram limit.
+	defaultUnixMaxPacketLen = defaultMaxPacketLen
+
+	// writeTimeout bounds the time spent writing a packet to a unix socket
+	// so a stalled agent does not hold the sender's queue forever.
+	writeTimeout = 100 * time.Millisecond
+)
+
+// Dial creates a datadog statsd sender connected to the agent at addr.
+//
+// The address is either host:port or an URL with the udp://, unix:// or
+// unixgram:// scheme, like unix:///var/run/datadog/dsd.socket. Each network
+// gets its own default max packet size which can be overridden with the
+// MaxPacketLen option. On unix stream sockets, each packet is prefixed with
+// its length as expected by the agent.
+//
+// UDP addresses are resolved again periodically as done by udp.Writer. Unix
+// sockets are redialed when a write fails, so the sender recovers when the
+// agent recreates its socket.
+func Dial(addr string, reportInterval time.Duration, opts ...Option) (xstats.Sender, error) {
+	network, address := parseAddr(addr)
+	var maxPacketLen int
+	switch network {
+	case "udp":
+		maxPacketLen = defaultUDPMaxPacketLen
+	case "unixgram":
+		maxPacketLen = defaultUnixgramMaxPacketLen
+	case "unix":
+		maxPacketLen = defaultUnixMaxPacketLen
+	default:
+		return nil, fmt.Errorf("dogstatsd: unsupported network %q", network)
+	}
+	var w io.WriteCloser
+	if network == "udp" {
+		uw, err := udp.Dial(address)
+		if err != nil {
+			return nil, err
+		}
+		w = uw
+	} else {
+		sw := &socketWriter{
+			network: network,
+			addr:    address,
+			stream:  network == "unix",
+		}
+		if err := sw.connect(); err != nil {
+			return nil, err
+		}
+		w = sw
+	}
+	opts = append([]Option{MaxPacketLen(maxPacketLen)}, opts...)
+	s := NewOptions(w, reportInterval, opts...).(*sender)
+	s.w = w
+	return s, nil
+}
+
+// parseAddr splits an address like unix:///path into its network and address.
+// Addresses without a scheme are UDP addresses.
+func parseAddr(addr string) (network, address string) {
+	if i := strings.Index(addr, "://"); i >= 0 {
+		return addr[:i], addr[i+3:]
+	}
+	return "udp", addr
+}
+
+// socketWriter writes packets to a unix socket, redialing it when a write fails.
+// It is only used from the sender's goroutine.
+type socketWriter struct {
+	network string
+	addr    string
+	stream  bool
+	conn    net.Conn
+	// frame holds the length prefixed packet on stream sockets.
+	frame []byte
+}
+
+func (w *socketWriter) connect() error {
+	conn, err := net.Dial(w.network, w.addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write implements io.Writer interface
+func (w *socketWriter) Write(p []byte) (int, error) {
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.write(p)
+	if err != nil {
+		// The agent may have recreated its socket, reconnect and retry once.
+		w.conn.Close()
+		w.conn = nil
+		if err = w.connect(); err != nil {
+			return 0, err
+		}
+		n, err = w.write(p)
+	}
+	return n, err
+}
+
+func (w *socketWriter) write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if !w.stream {
+		return w.conn.Write(p)
+	}
+	w.frame = w.frame[:0]
+	w.frame = append(w.frame, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(w.frame, uint32(len(p)))
+	w.frame = append(w.frame, p...)
+	if _, err := w.conn.Write(w.frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close implements io.Closer interface
+func (w *socketWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
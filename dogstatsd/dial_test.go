@@ -0,0 +1,169 @@
+package dogstatsd
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempSocket(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "dogstatsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "dsd.socket"), func() { os.RemoveAll(dir) }
+}
+
+func listenUnixgram(t *testing.T, path string) *net.UnixConn {
+	os.Remove(path)
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func readPacket(t *testing.T, c net.Conn) string {
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 1024)
+	n, err := c.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b[:n])
+}
+
+func readFrame(t *testing.T, c net.Conn) string {
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	var l uint32
+	if err := binary.Read(c, binary.LittleEndian, &l); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(c, b); err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParseAddr(t *testing.T) {
+	for addr, want := range map[string][2]string{
+		"127.0.0.1:8125":                 {"udp", "127.0.0.1:8125"},
+		"udp://127.0.0.1:8125":           {"udp", "127.0.0.1:8125"},
+		"unix:///var/run/dsd.socket":     {"unix", "/var/run/dsd.socket"},
+		"unixgram:///var/run/dsd.socket": {"unixgram", "/var/run/dsd.socket"},
+	} {
+		network, address := parseAddr(addr)
+		assert.Equal(t, want, [2]string{network, address}, addr)
+	}
+}
+
+func TestDialUnsupported(t *testing.T) {
+	_, err := Dial("tcp://127.0.0.1:8125", time.Second)
+	assert.EqualError(t, err, `dogstatsd: unsupported network "tcp"`)
+}
+
+func TestDialUnixgram(t *testing.T) {
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+	l := listenUnixgram(t, path)
+
+	c, err := Dial("unixgram://"+path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xstats.CloseSender(c)
+	assert.Equal(t, defaultUnixgramMaxPacketLen, c.(*sender).t.MaxPacketLen())
+
+	c.Count("metric1", 1, "tag1")
+	assert.Equal(t, "metric1:1|c|#tag1\n", readPacket(t, l))
+
+	// The agent recreates its socket
+	l.Close()
+	l = listenUnixgram(t, path)
+	defer l.Close()
+
+	c.Count("metric2", 2)
+	assert.Equal(t, "metric2:2|c\n", readPacket(t, l))
+}
+
+func TestDialUnix(t *testing.T) {
+	// A private channel so the senders of other tests don't take the ticks
+	tickC := make(chan time.Time)
+	tick = func(time.Duration) <-chan time.Time { return tickC }
+	defer func() { tick = time.Tick }()
+
+	path, cleanup := tempSocket(t)
+	defer cleanup()
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Dial("unix://"+path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xstats.CloseSender(c)
+	assert.Equal(t, defaultUnixMaxPacketLen, c.(*sender).t.MaxPacketLen())
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Count("metric1", 1, "tag1")
+	c.Gauge("metric2", 2)
+	tickC <- time.Now()
+	assert.Equal(t, "metric1:1|c|#tag1\nmetric2:2|g\n", readFrame(t, conn))
+
+	// The agent recreates its socket
+	conn.Close()
+	l.Close()
+	os.Remove(path)
+	l, err = net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c.Count("metric3", 3)
+	tickC <- time.Now()
+	conn, err = l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	assert.Equal(t, "metric3:3|c\n", readFrame(t, conn))
+}
+
+func TestDialUDP(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := Dial(l.LocalAddr().String(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, defaultUDPMaxPacketLen, c.(*sender).t.MaxPacketLen())
+
+	c.Count("metric1", 1)
+	xstats.CloseSender(c)
+	b := make([]byte, 1024)
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := l.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "metric1:1|c\n", string(b[:n]))
+}
@@ -3,11 +3,14 @@ package dogstatsd
 import (
 	"bytes"
 	"errors"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/rs/xstats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,7 +35,7 @@ func TestCounter(t *testing.T) {
 	c.Count("metric2", 2, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1:1.000000|c|#tag1\nmetric2:2.000000|c|#tag1,tag2\n", buf.String())
+	assert.Equal(t, "metric1:1|c|#tag1\nmetric2:2|c|#tag1,tag2\n", buf.String())
 }
 
 func TestGauge(t *testing.T) {
@@ -46,7 +49,7 @@ func TestGauge(t *testing.T) {
 	c.Gauge("metric2", -2.0, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1:1.000000|g|#tag1\nmetric2:-2.000000|g|#tag1,tag2\n", buf.String())
+	assert.Equal(t, "metric1:1|g|#tag1\nmetric2:-2|g|#tag1,tag2\n", buf.String())
 }
 
 func TestHistogram(t *testing.T) {
@@ -60,7 +63,7 @@ func TestHistogram(t *testing.T) {
 	c.Histogram("metric2", 2, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1:1.000000|h|#tag1\nmetric2:2.000000|h|#tag1,tag2\n", buf.String())
+	assert.Equal(t, "metric1:1|h|#tag1\nmetric2:2|h|#tag1,tag2\n", buf.String())
 }
 
 func TestTiming(t *testing.T) {
@@ -74,21 +77,78 @@ func TestTiming(t *testing.T) {
 	c.Timing("metric2", 2*time.Second, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1:1000.000000|ms|#tag1\nmetric2:2000.000000|ms|#tag1,tag2\n", buf.String())
+	assert.Equal(t, "metric1:1000|ms|#tag1\nmetric2:2000|ms|#tag1,tag2\n", buf.String())
+}
+
+func TestSet(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.SetSender)
+
+	c.Set("metric1", "user1", "tag1")
+	c.Set("metric2", "user2", "tag1", "tag2")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:user1|s|#tag1\nmetric2:user2|s|#tag1,tag2\n", buf.String())
+}
+
+func TestDistribution(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.DistributionSender)
+
+	c.Distribution("metric1", 1, "tag1")
+	c.Distribution("metric2", 2, "tag1", "tag2")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:1|d|#tag1\nmetric2:2|d|#tag1,tag2\n", buf.String())
+}
+
+func TestTimingAsDistribution(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Second, TimingAsDistribution()).(xstats.SampledSender)
+
+	c.Timing("metric1", time.Second, "tag1")
+	c.TimingSampled("metric2", 2*time.Second, 0.5, "tag1", "tag2")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:1000|d|#tag1\nmetric2:2000|d|@0.5|#tag1,tag2\n", buf.String())
+}
+
+func TestGaugeDelta(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.GaugeDeltaSender)
+
+	c.GaugeDelta("metric1", 1, "tag1")
+	c.GaugeDelta("metric1", -2.5, "tag1", "tag2")
+	c.GaugeDelta("metric2", 0)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:+1|g|#tag1\nmetric1:-2.5|g|#tag1,tag2\nmetric2:+0|g\n", buf.String())
+}
+
+func TestSampled(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.SampledSender)
+
+	c.CountSampled("metric1", 1, 0.5, "tag1")
+	c.HistogramSampled("metric2", 2, 0.1, "tag1", "tag2")
+	c.TimingSampled("metric3", time.Second, 0.25)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:1|c|@0.5|#tag1\nmetric2:2|h|@0.1|#tag1,tag2\nmetric3:1000|ms|@0.25\n", buf.String())
 }
 
 func TestMaxPacketLen(t *testing.T) {
 	buf := &bytes.Buffer{}
-	c := NewMaxPacket(buf, time.Hour, 32)
+	c := NewMaxPacket(buf, time.Hour, 18)
 
-	c.Count("metric1", 1.0) // len("metric1:1.000000|c\n") == 19
-	c.Count("met2", 1.0)    // len == 16
+	c.Count("metric1", 1.0) // len("metric1:1|c\n") == 12
+	c.Count("met2", 1.0)    // len == 9
 
 	for i := 0; i < 10 && buf.Len() == 0; i++ {
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	assert.Equal(t, "metric1:1.000000|c\n", buf.String())
+	assert.Equal(t, "metric1:1|c\n", buf.String())
 	buf.Reset()
 
 	c.Count("met3", 1.0)
@@ -96,7 +156,20 @@ func TestMaxPacketLen(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	assert.Equal(t, "met2:1.000000|c\nmet3:1.000000|c\n", buf.String())
+	assert.Equal(t, "met2:1|c\nmet3:1|c\n", buf.String())
+}
+
+func TestNewOptions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Hour, QueueSize(10), OnQueueFull(DropOldest))
+
+	c.Count("metric1", 1.0)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:1|c\n", buf.String())
+	assert.Equal(t, Stats{}, c.(interface {
+		Stats() Stats
+	}).Stats())
 }
 
 type errWriter struct{}
@@ -118,5 +191,110 @@ func TestInvalidBuffer(t *testing.T) {
 	c.Count("metric", 1)
 	wait(buf)
 
-	assert.Contains(t, buf.String(), "error: could not write to statsd: i/o error")
+	assert.Contains(t, buf.String(), "error: could not write to dogstatsd: i/o error")
+}
+
+func TestOnError(t *testing.T) {
+	var sender string
+	errs := make(chan error, 1)
+	c := NewOptions(&errWriter{}, time.Hour, OnError(func(err error, dropped int, s string) {
+		sender = s
+		errs <- err
+	}))
+
+	c.Count("metric", 1)
+	xstats.CloseSender(c)
+
+	assert.EqualError(t, <-errs, "i/o error")
+	assert.Equal(t, "dogstatsd", sender)
+	assert.Equal(t, Stats{WriteErrors: 1, DroppedBytes: 11}, c.(interface {
+		Stats() Stats
+	}).Stats())
+}
+
+func TestAggregate(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Hour, Aggregate()).(xstats.SampledSender)
+
+	c.Count("metric1", 1, "tag1")
+	c.Count("metric1", 2, "tag1")
+	c.CountSampled("metric1", 1, 0.5, "tag1")
+	c.Count("metric1", 1, "tag2")
+	c.Gauge("metric2", 1)
+	c.Gauge("metric2", 3)
+	c.(xstats.SetSender).Set("metric3", "user1")
+	c.(xstats.SetSender).Set("metric3", "user1")
+	c.(xstats.SetSender).Set("metric3", "user2")
+	c.Histogram("metric4", 1)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric4:1|h\n"+
+		"metric1:5|c|#tag1\n"+
+		"metric1:1|c|#tag2\n"+
+		"metric2:3|g\n"+
+		"metric3:user1|s\n"+
+		"metric3:user2|s\n", buf.String())
+}
+
+func TestAggregateHistograms(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Hour, AggregateHistograms()).(xstats.SampledSender)
+
+	c.Histogram("metric1", 1, "tag1")
+	c.Histogram("metric1", 2, "tag1")
+	c.Timing("metric2", time.Second)
+	c.Timing("metric2", 2*time.Second)
+	c.(xstats.DistributionSender).Distribution("metric3", 3)
+	c.HistogramSampled("metric1", 4, 0.5, "tag1")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:4|h|@0.5|#tag1\n"+
+		"metric1:1:2|h|#tag1\n"+
+		"metric2:1000:2000|ms\n"+
+		"metric3:3|d\n", buf.String())
+}
+
+func BenchmarkCount(b *testing.B) {
+	c := New(ioutil.Discard, time.Hour)
+	defer xstats.CloseSender(c)
+	tags := []string{"tag1:a", "tag2:b"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Count("metric1", 1, tags...)
+	}
+}
+
+func BenchmarkTiming(b *testing.B) {
+	c := New(ioutil.Discard, time.Hour)
+	defer xstats.CloseSender(c)
+	tags := []string{"tag1:a", "tag2:b"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Timing("metric1", 42*time.Millisecond, tags...)
+	}
+}
+
+func TestValues(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var errs []error
+	c := NewOptions(buf, time.Hour, OnError(func(err error, dropped int, s string) {
+		errs = append(errs, err)
+	}))
+
+	c.Gauge("metric1", 0.000001234)
+	c.Gauge("metric1", 12345678901)
+	c.Gauge("metric1", -0.5)
+	c.Gauge("metric2", math.NaN())
+	c.Count("metric2", math.Inf(1))
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1:0.000001234|g\nmetric1:12345678901|g\nmetric1:-0.5|g\n", buf.String())
+	if assert.Len(t, errs, 2) {
+		assert.EqualError(t, errs[0], "xstats: invalid value NaN for metric2")
+		assert.Equal(t, &xstats.InvalidValueError{Stat: "metric2", Value: math.Inf(1)}, errs[1])
+	}
 }
@@ -0,0 +1,87 @@
+package dogstatsd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/rs/xstats"
+	"github.com/rs/xstats/internal/transport"
+)
+
+// Event implements xstats.EventSender interface
+//
+// The hostname, aggregation key and source type name are sanitized like tags.
+func (s *sender) Event(e xstats.Event) {
+	fields, ok := s.t.SanitizeTags(e.Title,
+		append([]string{e.Hostname, e.AggregationKey, e.SourceTypeName}, e.Tags...))
+	if !ok {
+		return
+	}
+	title := escapeEventText(e.Title)
+	text := escapeEventText(e.Text)
+	b := transport.GetBuffer()
+	b.B = append(b.B, "_e{"...)
+	b.B = strconv.AppendInt(b.B, int64(len(title)), 10)
+	b.B = append(b.B, ',')
+	b.B = strconv.AppendInt(b.B, int64(len(text)), 10)
+	b.B = append(b.B, "}:"...)
+	b.B = append(b.B, title...)
+	b.B = append(b.B, '|')
+	b.B = append(b.B, text...)
+	if !e.Timestamp.IsZero() {
+		b.B = append(b.B, "|d:"...)
+		b.B = strconv.AppendInt(b.B, e.Timestamp.Unix(), 10)
+	}
+	b.B = appendField(b.B, "|h:", fields[0])
+	b.B = appendField(b.B, "|k:", fields[1])
+	b.B = appendField(b.B, "|p:", string(e.Priority))
+	b.B = appendField(b.B, "|s:", fields[2])
+	b.B = appendField(b.B, "|t:", string(e.AlertType))
+	b.B = appendTags(b.B, fields[3:])
+	b.B = append(b.B, '\n')
+	s.t.SendBuffer(b)
+}
+
+// ServiceCheck implements xstats.EventSender interface
+//
+// The name is sanitized like a stat name and the hostname like a tag.
+func (s *sender) ServiceCheck(sc xstats.ServiceCheck) {
+	name, fields, ok := s.t.Sanitize(sc.Name, append([]string{sc.Hostname}, sc.Tags...))
+	if !ok {
+		return
+	}
+	b := transport.GetBuffer()
+	b.B = append(b.B, "_sc|"...)
+	b.B = append(b.B, name...)
+	b.B = append(b.B, '|')
+	b.B = strconv.AppendInt(b.B, int64(sc.Status), 10)
+	if !sc.Timestamp.IsZero() {
+		b.B = append(b.B, "|d:"...)
+		b.B = strconv.AppendInt(b.B, sc.Timestamp.Unix(), 10)
+	}
+	b.B = appendField(b.B, "|h:", fields[0])
+	b.B = appendTags(b.B, fields[1:])
+	// The message must be the last field
+	b.B = appendField(b.B, "|m:", escapeServiceCheckMessage(sc.Message))
+	b.B = append(b.B, '\n')
+	s.t.SendBuffer(b)
+}
+
+// appendField appends an optional field if its value is not empty.
+func appendField(b []byte, prefix, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = append(b, prefix...)
+	return append(b, value...)
+}
+
+// escapeEventText escapes new lines which would end the event.
+func escapeEventText(s string) string {
+	return strings.Replace(s, "\n", "\\n", -1)
+}
+
+// escapeServiceCheckMessage escapes new lines and the message field prefix.
+func escapeServiceCheckMessage(s string) string {
+	return strings.Replace(escapeEventText(s), "m:", "m\\:", -1)
+}
@@ -0,0 +1,102 @@
+package dogstatsd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.EventSender)
+
+	c.Event(xstats.Event{Title: "deploy", Text: "v1.2\nby bob"})
+	c.Event(xstats.Event{
+		Title:          "deploy",
+		Text:           "failed",
+		Timestamp:      time.Unix(1500000000, 0),
+		Hostname:       "host1",
+		AggregationKey: "deploy-42",
+		Priority:       xstats.PriorityLow,
+		SourceTypeName: "jenkins",
+		AlertType:      xstats.AlertError,
+		Tags:           []string{"tag1", "tag2"},
+	})
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "_e{6,12}:deploy|v1.2\\nby bob\n"+
+		"_e{6,6}:deploy|failed|d:1500000000|h:host1|k:deploy-42|p:low|s:jenkins|t:error|#tag1,tag2\n", buf.String())
+}
+
+func TestServiceCheck(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.EventSender)
+
+	c.ServiceCheck(xstats.ServiceCheck{Name: "db.up"})
+	c.ServiceCheck(xstats.ServiceCheck{
+		Name:      "db.up",
+		Status:    xstats.StatusCritical,
+		Timestamp: time.Unix(1500000000, 0),
+		Hostname:  "host1",
+		Message:   "down\nm:1",
+		Tags:      []string{"tag1"},
+	})
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "_sc|db.up|0\n"+
+		"_sc|db.up|2|d:1500000000|h:host1|#tag1|m:down\\nm\\:1\n", buf.String())
+}
+
+func TestEventXStaterTags(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second)
+	xs := xstats.NewPrefix(c, "p.")
+	xs.AddTags("env:prod")
+
+	xs.Event(xstats.Event{Title: "a", Text: "b", Tags: []string{"tag1"}})
+	xs.ServiceCheck(xstats.ServiceCheck{Name: "c", Status: xstats.StatusOK})
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "_e{1,1}:a|b|#tag1,env:prod\n_sc|p.c|0|#env:prod\n", buf.String())
+}
+
+func TestEventSanitize(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.EventSender)
+
+	c.Event(xstats.Event{
+		Title:          "a|b",
+		Text:           "c",
+		Hostname:       "host|1",
+		AggregationKey: "key,1",
+		SourceTypeName: "src\n1",
+		Tags:           []string{"tag|1", "tag\n2"},
+	})
+	c.ServiceCheck(xstats.ServiceCheck{Name: "db|up", Hostname: "host|1", Tags: []string{"tag,1"}})
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "_e{3,1}:a|b|c|h:host_1|k:key_1|s:src_1|#tag_1,tag_2\n"+
+		"_sc|db_up|0|h:host_1|#tag_1\n", buf.String())
+}
+
+func TestEventRejectInvalid(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var errs []error
+	c := NewOptions(buf, time.Second, OnInvalidName(xstats.RejectInvalid),
+		OnError(func(err error, dropped int, sender string) { errs = append(errs, err) })).(xstats.EventSender)
+
+	c.Event(xstats.Event{Title: "a", Hostname: "host|1"})
+	c.Event(xstats.Event{Title: "b", Tags: []string{"tag|1"}})
+	c.ServiceCheck(xstats.ServiceCheck{Name: "db|up"})
+	c.Event(xstats.Event{Title: "c", Hostname: "host1"})
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "_e{1,0}:c||h:host1\n", buf.String())
+	if assert.Len(t, errs, 3) {
+		assert.Equal(t, &xstats.InvalidNameError{Stat: "a", Tags: []string{"host|1", "", ""}}, errs[0])
+		assert.Equal(t, "db|up", errs[2].(*xstats.InvalidNameError).Stat)
+	}
+}
@@ -0,0 +1,46 @@
+package dogstatsd
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sanitizer is the default xstats.Sanitizer of dogstatsd senders. It replaces
+// the characters reserved by the DogStatsD protocol and white spaces with '_':
+// ':', '|', '@', '#' and ',' in stat names and '|', '#' and ',' in tags, where
+// ':' separates the key from the value.
+type Sanitizer struct{}
+
+// Name implements xstats.Sanitizer interface
+func (Sanitizer) Name(stat string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ':' || r == '@' {
+			return '_'
+		}
+		return replaceReserved(r)
+	}, stat)
+}
+
+// Tag implements xstats.Sanitizer interface
+func (Sanitizer) Tag(tag string) string {
+	return strings.Map(replaceReserved, tag)
+}
+
+// Value implements xstats.ValueSanitizer interface - replaces ':', '|', '#',
+// ',' and new lines in set values with '_'.
+func (Sanitizer) Value(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ':' || r == '|' || r == '#' || r == ',' || r == '\n' || r == '\r' {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func replaceReserved(r rune) rune {
+	switch {
+	case r == '|' || r == '#' || r == ',' || unicode.IsSpace(r):
+		return '_'
+	}
+	return r
+}
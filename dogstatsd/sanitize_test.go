@@ -0,0 +1,56 @@
+package dogstatsd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizer(t *testing.T) {
+	s := Sanitizer{}
+	assert.Equal(t, "foo.bar-baz_1", s.Name("foo.bar-baz_1"))
+	assert.Equal(t, "foo_bar_baz_q_r_s_", s.Name("foo:bar|baz@q#r,s "))
+	assert.Equal(t, "env:prod", s.Tag("env:prod"))
+	assert.Equal(t, "path:/a_b_c_d", s.Tag("path:/a,b|c#d"))
+	assert.Equal(t, "user-1 a", s.Value("user-1 a"))
+	assert.Equal(t, "a_b_c_d_e_", s.Value("a|b:c,d#e\n"))
+}
+
+func TestSanitize(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Hour)
+	tags := []string{"env:prod", "a:b,c"}
+	c.Count("foo|bar", 1, tags...)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "foo_bar:1|c|#env:prod,a:b_c\n", buf.String())
+	assert.Equal(t, []string{"env:prod", "a:b,c"}, tags)
+}
+
+func TestSanitizeSetValue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Hour, Aggregate()).(xstats.SetSender)
+	c.Set("foo", "a|s|#x\nbar:1|c", "env:prod")
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo:a_s__x_bar_1_c|s|#env:prod\n", buf.String())
+}
+
+func TestOnInvalidName(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var errs []error
+	c := NewOptions(buf, time.Hour, OnInvalidName(xstats.RejectInvalid), OnError(func(err error, dropped int, s string) {
+		errs = append(errs, err)
+	}))
+	c.Count("foo", 1, "a:b,c")
+	c.Count("foo", 1, "a:b")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "foo:1|c|#a:b\n", buf.String())
+	assert.Equal(t, []error{&xstats.InvalidNameError{Stat: "foo", Tags: []string{"a:b,c"}}}, errs)
+	assert.Equal(t, Stats{InvalidNames: 1}, c.(interface {
+		Stats() Stats
+	}).Stats())
+}
@@ -0,0 +1,93 @@
+package xstats
+
+import "time"
+
+// EventPriority is the priority of an Event.
+type EventPriority string
+
+const (
+	// PriorityNormal is the default event priority.
+	PriorityNormal EventPriority = "normal"
+	// PriorityLow is the priority of events hidden by default.
+	PriorityLow EventPriority = "low"
+)
+
+// EventAlertType is the alert type of an Event.
+type EventAlertType string
+
+const (
+	// AlertInfo is the default event alert type.
+	AlertInfo EventAlertType = "info"
+	// AlertError marks an event as an error.
+	AlertError EventAlertType = "error"
+	// AlertWarning marks an event as a warning.
+	AlertWarning EventAlertType = "warning"
+	// AlertSuccess marks an event as a success.
+	AlertSuccess EventAlertType = "success"
+)
+
+// Event is a record of a notable occurrence, like a deployment. Optional
+// fields are omitted when empty.
+type Event struct {
+	// Title of the event, required.
+	Title string
+	// Text of the event, required.
+	Text string
+	// Timestamp of the event, the backend uses the reception time if zero.
+	Timestamp time.Time
+	// Hostname the event is attached to.
+	Hostname string
+	// AggregationKey groups the events sharing it.
+	AggregationKey string
+	// Priority of the event.
+	Priority EventPriority
+	// SourceTypeName is the source of the event, like "jenkins".
+	SourceTypeName string
+	// AlertType of the event.
+	AlertType EventAlertType
+	// Tags of the event.
+	Tags []string
+}
+
+// ServiceCheckStatus is the status of a ServiceCheck.
+type ServiceCheckStatus int
+
+const (
+	// StatusOK reports a healthy service.
+	StatusOK ServiceCheckStatus = iota
+	// StatusWarning reports a degraded service.
+	StatusWarning
+	// StatusCritical reports a failing service.
+	StatusCritical
+	// StatusUnknown reports a service in an unknown state.
+	StatusUnknown
+)
+
+// ServiceCheck reports the status of a service. Optional fields are omitted
+// when empty.
+type ServiceCheck struct {
+	// Name of the service check, required.
+	Name string
+	// Status of the service.
+	Status ServiceCheckStatus
+	// Timestamp of the check, the backend uses the reception time if zero.
+	Timestamp time.Time
+	// Hostname the check is attached to.
+	Hostname string
+	// Message describing the status.
+	Message string
+	// Tags of the service check.
+	Tags []string
+}
+
+// EventSender is an optional interface for Sender supporting events and
+// service checks.
+type EventSender interface {
+	Sender
+
+	// Event sends an event.
+	Event(e Event)
+
+	// ServiceCheck sends a service check.
+	ServiceCheck(sc ServiceCheck)
+}
@@ -3,13 +3,22 @@ package expvar
 import (
 	"expvar"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/rs/xstats"
+	"github.com/rs/xstats/internal/uniq"
 )
 
+// setInterval is the interval over which unique values of sets are counted.
+const setInterval = 10 * time.Second
+
+var now = time.Now
+
 type sender struct {
 	vars *expvar.Map
+	// mu protects sets creation and gauge deltas
+	mu *sync.Mutex
 }
 
 // A expvar.Var static float
@@ -20,12 +29,24 @@ func (f float) String() string {
 	return strconv.FormatFloat(float64(f), 'g', -1, 64)
 }
 
+// A expvar.Var counting unique values
+type set struct {
+	*uniq.Counter
+}
+
+// String implements the expvar.Var
+func (s set) String() string {
+	return strconv.Itoa(s.Count())
+}
+
 // New creates a statsd sender that publish observations in expvar under
 // the given prefix "path". Will panic if the prefix is already used.
 //
-// Tags are ignored. Histogram and Timing methods are not supported.
+// Tags are ignored. Histogram and Timing methods are not supported. Sets are
+// published as the number of unique values seen during the last 10 seconds
+// interval.
 func New(prefix string) xstats.Sender {
-	return &sender{expvar.NewMap(prefix)}
+	return &sender{expvar.NewMap(prefix), &sync.Mutex{}}
 }
 
 // Gauge implements xstats.Sender interface
@@ -38,6 +59,21 @@ func (s sender) Count(stat string, count float64, tags ...string) {
 	s.vars.AddFloat(stat, count)
 }
 
+// GaugeDelta implements xstats.GaugeDeltaSender interface - simulates it by
+// adding delta to the gauge value.
+func (s sender) GaugeDelta(stat string, delta float64, tags ...string) {
+	s.mu.Lock()
+	switch v := s.vars.Get(stat).(type) {
+	case float:
+		s.vars.Set(stat, v+float(delta))
+	case *expvar.Float:
+		v.Add(delta)
+	default:
+		s.vars.Set(stat, float(delta))
+	}
+	s.mu.Unlock()
+}
+
 // Histogram implements xstats.Sender interface
 func (s sender) Histogram(stat string, value float64, tags ...string) {
 	// Not supported, just ignored
@@ -47,3 +83,15 @@ func (s sender) Histogram(stat string, value float64, tags ...string) {
 func (s sender) Timing(stat string, duration time.Duration, tags ...string) {
 	// Not supported, just ignored
 }
+
+// Set implements xstats.SetSender interface
+func (s sender) Set(stat string, value string, tags ...string) {
+	s.mu.Lock()
+	v, ok := s.vars.Get(stat).(set)
+	if !ok {
+		v = set{uniq.NewClock(setInterval, func() time.Time { return now() })}
+		s.vars.Set(stat, v)
+	}
+	s.mu.Unlock()
+	v.Add(value)
+}
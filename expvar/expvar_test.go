@@ -3,7 +3,9 @@ package expvar
 import (
 	"expvar"
 	"testing"
+	"time"
 
+	"github.com/rs/xstats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,6 +38,19 @@ func TestCount(t *testing.T) {
 	assert.Equal(t, "0", v.Get("test").String())
 }
 
+func TestGaugeDelta(t *testing.T) {
+	s := New("gaugedelta").(xstats.GaugeDeltaSender)
+	v := expvar.Get("gaugedelta").(*expvar.Map)
+	s.GaugeDelta("test", -1)
+	assert.Equal(t, "-1", v.Get("test").String())
+	s.Gauge("test", 2)
+	s.GaugeDelta("test", 1.5)
+	assert.Equal(t, "3.5", v.Get("test").String())
+	s.Count("count", 1)
+	s.GaugeDelta("count", 1)
+	assert.Equal(t, "2", v.Get("count").String())
+}
+
 func TestHistogram(t *testing.T) {
 	s := New("histogram")
 	s.Histogram("test", 1)
@@ -45,3 +60,24 @@ func TestTiming(t *testing.T) {
 	s := New("timing")
 	s.Timing("test", 1)
 }
+
+func TestSet(t *testing.T) {
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	s := New("set").(xstats.SetSender)
+	v := expvar.Get("set").(*expvar.Map)
+	s.Set("test", "a")
+	s.Set("test", "b")
+	s.Set("test", "a")
+	// Sets report the unique values of the last completed interval
+	assert.Equal(t, "0", v.Get("test").String())
+	start = start.Add(setInterval)
+	assert.Equal(t, "2", v.Get("test").String())
+	s.Set("test", "c")
+	start = start.Add(setInterval)
+	assert.Equal(t, "1", v.Get("test").String())
+	start = start.Add(setInterval)
+	assert.Equal(t, "0", v.Get("test").String())
+}
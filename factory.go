@@ -0,0 +1,50 @@
+package xstats
+
+// Factory creates XStater instances sharing a sender and a lifecycle. Unlike
+// the package level functions, it doesn't depend on DisablePooling once
+// created, so different parts of a program can use different lifecycles.
+type Factory struct {
+	s       Sender
+	pooling bool
+}
+
+// FactoryOption configures a Factory.
+type FactoryOption func(*Factory)
+
+// WithPooling sets whether the instances created by the factory are taken from
+// a pool and returned to it when closed. Pooled instances must not be used
+// after close. Defaults to !DisablePooling when the factory is created.
+func WithPooling(enabled bool) FactoryOption {
+	return func(f *Factory) {
+		f.pooling = enabled
+	}
+}
+
+// NewFactory returns a factory of xstats clients with the provided backend
+// sender.
+func NewFactory(s Sender, opts ...FactoryOption) *Factory {
+	f := &Factory{
+		s:       s,
+		pooling: !DisablePooling,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// New returns a new xstats client like the New function.
+func (f *Factory) New() XStater {
+	return f.NewPrefix("")
+}
+
+// NewPrefix returns a new xstats client like the NewPrefix function.
+func (f *Factory) NewPrefix(prefix string) XStater {
+	return f.NewScoping("", prefix)
+}
+
+// NewScoping returns a new xstats client like the NewScoping function. Its
+// copies and scopes have the same lifecycle.
+func (f *Factory) NewScoping(delimiter string, scopes ...string) XStater {
+	return newScoping(f.s, f.pooling, delimiter, scopes...)
+}
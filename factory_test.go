@@ -0,0 +1,66 @@
+package xstats
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFactoryWithoutPooling(t *testing.T) {
+	defer func(pool *sync.Pool) {
+		xstatsPool = pool
+	}(xstatsPool)
+	xstatsPool = &sync.Pool{
+		New: func() interface{} {
+			assert.Fail(t, "pool used while disabled")
+			return nil
+		},
+	}
+
+	s := &fakeSender{}
+	f := NewFactory(s, WithPooling(false))
+	xs := f.NewScoping(".", "prefix")
+	xs.AddTags("foo")
+	xs2 := Scope(Copy(xs), "scope")
+	Close(xs)
+	Close(xs2)
+
+	// Closed instances keep their state
+	xs.Count("metric", 1)
+	assert.Equal(t, cmd{"Count", "prefix.metric", 1, []string{"foo"}}, s.last)
+	xs2.Count("metric", 2)
+	assert.Equal(t, cmd{"Count", "prefix.scope.metric", 2, []string{"foo"}}, s.last)
+}
+
+func TestFactoryPooling(t *testing.T) {
+	called := false
+	OnUseAfterClose = func(err *UseAfterCloseError) {
+		called = true
+	}
+	defer func(value bool) {
+		OnUseAfterClose = nil
+		DisablePooling = value
+	}(DisablePooling)
+	DisablePooling = true
+
+	f := NewFactory(&fakeSender{}, WithPooling(true))
+	xs := f.NewScoping("/", "a", "b").(*xstats)
+	assert.Equal(t, "a/b/", xs.prefix)
+	assert.False(t, xs.detached)
+	xs.Close()
+	xs.Count("metric", 1)
+	assert.True(t, called)
+}
+
+func TestFactoryDefault(t *testing.T) {
+	defer func(value bool) {
+		DisablePooling = value
+	}(DisablePooling)
+
+	DisablePooling = true
+	f := NewFactory(&fakeSender{})
+	DisablePooling = false
+	assert.True(t, f.New().(*xstats).detached)
+	assert.False(t, NewFactory(&fakeSender{}).New().(*xstats).detached)
+}
@@ -13,8 +13,10 @@ import (
 // retrived using xstats.FromContext(ctx)
 type Handler struct {
 	s      Sender
+	f      *Factory
 	tags   []string
 	prefix string
+	detach bool
 }
 
 type key int
@@ -39,22 +41,41 @@ func FromContext(ctx context.Context) XStater {
 
 // NewHandler creates a new handler with the provided metric client.
 // If some tags are provided, the will be added to all logged metrics.
-func NewHandler(s Sender, tags []string) func(xhandler.HandlerC) xhandler.HandlerC {
-	return NewHandlerPrefix(s, tags, "")
+func NewHandler(s Sender, tags []string, opts ...HandlerOption) func(xhandler.HandlerC) xhandler.HandlerC {
+	return NewHandlerPrefix(s, tags, "", opts...)
 }
 
 // NewHandlerPrefix creates a new handler with the provided metric client.
 // If some tags are provided, the will be added to all logged metrics.
 // If the prefix argument is provided, all produced metrics will have this
 // prefix prepended.
-func NewHandlerPrefix(s Sender, tags []string, prefix string) func(xhandler.HandlerC) xhandler.HandlerC {
-	return func(next xhandler.HandlerC) xhandler.HandlerC {
-		return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-			xs := NewPrefix(s, prefix).(*xstats)
-			xs.AddTags(tags...)
-			ctx = NewContext(ctx, xs)
-			next.ServeHTTPC(ctx, w, r)
-			xs.Close()
-		})
-	}
+//
+// The instance of a request is closed when the handler returns, unless the
+// DetachRequests option is given. Goroutines outliving the request must use
+// their own xstats.Detach copy. DisablePooling is read on each request.
+func NewHandlerPrefix(s Sender, tags []string, prefix string, opts ...HandlerOption) func(xhandler.HandlerC) xhandler.HandlerC {
+	return newHandler(s, nil, tags, prefix, opts).middleware
+}
+
+// NewHandler creates a new handler like the NewHandler function, building
+// the instance of each request with the factory.
+func (f *Factory) NewHandler(tags []string, opts ...HandlerOption) func(xhandler.HandlerC) xhandler.HandlerC {
+	return f.NewHandlerPrefix(tags, "", opts...)
+}
+
+// NewHandlerPrefix creates a new handler like the NewHandlerPrefix function,
+// building the instance of each request with the factory.
+func (f *Factory) NewHandlerPrefix(tags []string, prefix string, opts ...HandlerOption) func(xhandler.HandlerC) xhandler.HandlerC {
+	return newHandler(f.s, f, tags, prefix, opts).middleware
+}
+
+// middleware wraps next with the handler.
+func (h *Handler) middleware(next xhandler.HandlerC) xhandler.HandlerC {
+	return xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		xs := newScoping(h.s, h.pooling(), "", h.prefix)
+		xs.AddTags(h.tags...)
+		ctx = NewContext(ctx, xs)
+		next.ServeHTTPC(ctx, w, r)
+		xs.Close()
+	})
 }
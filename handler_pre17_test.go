@@ -35,3 +35,29 @@ func TestHandlerPrefix(t *testing.T) {
 	h := NewHandlerPrefix(s, []string{"envtag"}, "prefix.")(n)
 	h.ServeHTTPC(context.Background(), nil, nil)
 }
+
+func TestHandlerDetachRequests(t *testing.T) {
+	s := &fakeSender{}
+	var xs XStater
+	n := xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		xs = FromContext(ctx)
+	})
+	h := NewHandler(s, []string{"envtag"}, DetachRequests())(n)
+	h.ServeHTTPC(context.Background(), nil, nil)
+
+	xs.Count("metric", 1)
+	assert.Equal(t, cmd{"Count", "metric", 1, []string{"envtag"}}, s.last)
+}
+
+func TestFactoryHandler(t *testing.T) {
+	s := &fakeSender{}
+	var xs XStater
+	n := xhandler.HandlerFuncC(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		xs = FromContext(ctx)
+	})
+	h := NewFactory(s, WithPooling(false)).NewHandlerPrefix([]string{"envtag"}, "prefix.")(n)
+	h.ServeHTTPC(context.Background(), nil, nil)
+
+	xs.Count("metric", 1)
+	assert.Equal(t, cmd{"Count", "prefix.metric", 1, []string{"envtag"}}, s.last)
+}
@@ -33,3 +33,77 @@ func TestHandlerPrefix(t *testing.T) {
 	h := NewHandlerPrefix(s, []string{"envtag"}, "prefix.")(n)
 	h.ServeHTTP(nil, &http.Request{})
 }
+
+func TestHandlerDetachRequests(t *testing.T) {
+	called := false
+	OnUseAfterClose = func(err *UseAfterCloseError) {
+		called = true
+	}
+	defer func() { OnUseAfterClose = nil }()
+
+	s := &fakeSender{}
+	var xs XStater
+	n := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		xs = FromRequest(r)
+	})
+	h := NewHandler(s, []string{"envtag"}, DetachRequests())(n)
+	h.ServeHTTP(nil, &http.Request{})
+
+	xs.Count("metric", 1)
+	assert.False(t, called)
+	assert.Equal(t, cmd{"Count", "metric", 1, []string{"envtag"}}, s.last)
+}
+
+func TestHandlerDisablePooling(t *testing.T) {
+	defer func(value bool) {
+		DisablePooling = value
+	}(DisablePooling)
+	DisablePooling = false
+
+	var xs XStater
+	n := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		xs = FromRequest(r)
+	})
+	h := NewHandler(&fakeSender{}, nil)(n)
+	h.ServeHTTP(nil, &http.Request{})
+	assert.False(t, xs.(*xstats).detached)
+
+	// The handler reads DisablePooling on each request
+	DisablePooling = true
+	h.ServeHTTP(nil, &http.Request{})
+	assert.True(t, xs.(*xstats).detached)
+}
+
+func TestHandlerUseAfterClose(t *testing.T) {
+	var err *UseAfterCloseError
+	OnUseAfterClose = func(e *UseAfterCloseError) {
+		err = e
+	}
+	defer func() { OnUseAfterClose = nil }()
+
+	var xs XStater
+	n := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		xs = FromRequest(r)
+	})
+	h := NewHandler(&fakeSender{}, nil)(n)
+	h.ServeHTTP(nil, &http.Request{})
+
+	xs.Count("metric", 1)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "metric", err.Stat)
+	}
+}
+
+func TestFactoryHandler(t *testing.T) {
+	s := &fakeSender{}
+	var xs XStater
+	n := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		xs = FromRequest(r)
+		assert.Equal(t, "prefix.", xs.(*xstats).prefix)
+	})
+	h := NewFactory(s, WithPooling(false)).NewHandlerPrefix([]string{"envtag"}, "prefix.")(n)
+	h.ServeHTTP(nil, &http.Request{})
+
+	xs.Count("metric", 1)
+	assert.Equal(t, cmd{"Count", "prefix.metric", 1, []string{"envtag"}}, s.last)
+}
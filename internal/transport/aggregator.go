@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Format formats a line for a stat of the given metric type with one or more
+// values, joined with ':' in the statsd protocols.
+type Format func(stat, typ string, values []string, tags []string) string
+
+// Aggregator accumulates observations between two flushes of a transport and
+// writes one line per stat, type and tags: counts and gauge deltas are summed,
+// the last gauge value is kept and set values are deduplicated. Histogram-like
+// observations are buffered and sent as multi-value lines if enabled, early
+// once a line would exceed the max packet length.
+type Aggregator struct {
+	format       Format
+	histograms   bool
+	maxPacketLen int
+	// send queues the lines of histogram-like values flushed early.
+	send func(line string)
+
+	mu      sync.Mutex
+	metrics map[string]*aggregate
+	// order keeps the order in which keys were first seen so lines are
+	// written in a stable order.
+	order []string
+}
+
+// aggregate holds the observations of one stat, type and tags.
+type aggregate struct {
+	stat   string
+	typ    string
+	tags   []string
+	value  float64
+	values []string
+	// size is the length of the line of the buffered values.
+	size int
+	set  map[string]struct{}
+	// delta is set if value is a gauge delta, no absolute gauge value having
+	// been seen since the last flush.
+	delta bool
+}
+
+func newAggregator(format Format, histograms bool, maxPacketLen int, send func(line string)) *Aggregator {
+	return &Aggregator{
+		format:       format,
+		histograms:   histograms,
+		maxPacketLen: maxPacketLen,
+		send:         send,
+		metrics:      make(map[string]*aggregate),
+	}
+}
+
+// get returns the aggregate for a stat, type and tags, creating it if needed.
+// It must be called with the lock held.
+func (a *Aggregator) get(stat, typ string, tags []string) *aggregate {
+	k := key(stat, typ, tags)
+	m, ok := a.metrics[k]
+	if !ok {
+		m = &aggregate{
+			stat: stat,
+			typ:  typ,
+			// Copy the tags as the caller may reuse them
+			tags: append([]string(nil), tags...),
+		}
+		a.metrics[k] = m
+		a.order = append(a.order, k)
+	}
+	return m
+}
+
+// key returns the key of the aggregate of a stat, type and tags. The stat and
+// tags are prefixed with their length as they may contain any character if
+// they are not sanitized.
+func key(stat, typ string, tags []string) string {
+	n := len(stat) + len(typ) + 4
+	for _, t := range tags {
+		n += len(t) + 4
+	}
+	b := make([]byte, 0, n)
+	b = strconv.AppendInt(b, int64(len(stat)), 10)
+	b = append(b, ':')
+	b = append(b, stat...)
+	b = append(b, typ...)
+	for _, t := range tags {
+		b = append(b, '|')
+		b = strconv.AppendInt(b, int64(len(t)), 10)
+		b = append(b, ':')
+		b = append(b, t...)
+	}
+	return string(b)
+}
+
+// Count adds a count to the sum of the stat.
+func (a *Aggregator) Count(stat string, count float64, tags []string) {
+	a.mu.Lock()
+	a.get(stat, "c", tags).value += count
+	a.mu.Unlock()
+}
+
+// Gauge sets the value of the stat, only the last value is sent.
+func (a *Aggregator) Gauge(stat string, value float64, tags []string) {
+	a.mu.Lock()
+	m := a.get(stat, "g", tags)
+	m.value = value
+	m.delta = false
+	a.mu.Unlock()
+}
+
+// GaugeDelta adds a delta to the value of the stat. Deltas following a gauge
+// value are added to it, otherwise their sum is sent as a delta.
+func (a *Aggregator) GaugeDelta(stat string, delta float64, tags []string) {
+	a.mu.Lock()
+	m, ok := a.metrics[key(stat, "g", tags)]
+	if !ok {
+		m = a.get(stat, "g", tags)
+		m.delta = true
+	}
+	m.value += delta
+	a.mu.Unlock()
+}
+
+// Set adds a value to the set of the stat, each unique value is sent once.
+func (a *Aggregator) Set(stat string, value string, tags []string) {
+	a.mu.Lock()
+	m := a.get(stat, "s", tags)
+	if m.set == nil {
+		m.set = make(map[string]struct{})
+	}
+	if _, ok := m.set[value]; !ok {
+		m.set[value] = struct{}{}
+		m.values = append(m.values, value)
+	}
+	a.mu.Unlock()
+}
+
+// Sample buffers a histogram-like value of the given type. It returns false
+// if histograms are not aggregated, in which case the caller must send the
+// value itself.
+func (a *Aggregator) Sample(stat, typ string, value float64, tags []string) bool {
+	if !a.histograms {
+		return false
+	}
+	v := formatValue(value)
+	var line string
+	a.mu.Lock()
+	m := a.get(stat, typ, tags)
+	if len(m.values) > 0 && a.maxPacketLen > 0 && m.size+1+len(v) > a.maxPacketLen {
+		// Flush the buffered values, keeping the aggregate so the next ones
+		// are flushed as multi-value lines too
+		line = a.format(m.stat, m.typ, m.values, m.tags)
+		m.values = m.values[:0]
+	}
+	if len(m.values) == 0 {
+		m.size = len(a.format(m.stat, m.typ, []string{""}, m.tags))
+	} else {
+		m.size++
+	}
+	m.size += len(v)
+	m.values = append(m.values, v)
+	a.mu.Unlock()
+	if line != "" {
+		a.send(line)
+	}
+	return true
+}
+
+// flush writes the aggregated lines and resets the aggregator.
+func (a *Aggregator) flush(write func(line string)) {
+	a.mu.Lock()
+	metrics, order := a.metrics, a.order
+	a.metrics = make(map[string]*aggregate, len(metrics))
+	a.order = make([]string, 0, len(order))
+	a.mu.Unlock()
+
+	for _, k := range order {
+		m := metrics[k]
+		if m.values == nil {
+			v := formatValue(m.value)
+			if m.delta && m.value >= 0 {
+				v = "+" + v
+			}
+			write(a.format(m.stat, m.typ, []string{v}, m.tags))
+			continue
+		}
+		if m.typ == "s" {
+			// Set values can't be packed in a single line
+			for _, v := range m.values {
+				write(a.format(m.stat, m.typ, []string{v}, m.tags))
+			}
+			continue
+		}
+		a.writeValues(m, write)
+	}
+}
+
+// writeValues writes multi-value lines, splitting them to fit in a packet.
+func (a *Aggregator) writeValues(m *aggregate, write func(line string)) {
+	base := len(a.format(m.stat, m.typ, []string{""}, m.tags))
+	start, l := 0, base
+	for i, v := range m.values {
+		if i > start && l+1+len(v) > a.maxPacketLen {
+			write(a.format(m.stat, m.typ, m.values[start:i], m.tags))
+			start, l = i, base
+		}
+		if i > start {
+			l++
+		}
+		l += len(v)
+	}
+	write(a.format(m.stat, m.typ, m.values[start:], m.tags))
+}
+
+// formatValue formats a value like AppendValue.
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testFormat(stat, typ string, values []string, tags []string) string {
+	return stat + ":" + strings.Join(values, ":") + "|" + typ + "\n"
+}
+
+func flushLines(a *Aggregator) []string {
+	var lines []string
+	a.flush(func(line string) { lines = append(lines, line) })
+	return lines
+}
+
+func TestAggregator(t *testing.T) {
+	a := newAggregator(testFormat, false, 1024, nil)
+	tags := []string{"tag1"}
+	a.Count("c", 1, tags)
+	tags[0] = "tag2"
+	a.Count("c", 2, []string{"tag1"})
+	a.Gauge("g", 1, nil)
+	a.Gauge("g", 2, nil)
+	a.Set("s", "a", nil)
+	a.Set("s", "b", nil)
+	a.Set("s", "a", nil)
+	assert.False(t, a.Sample("h", "h", 1, nil))
+
+	assert.Equal(t, []string{"c:3|c\n", "g:2|g\n", "s:a|s\n", "s:b|s\n"}, flushLines(a))
+	assert.Nil(t, flushLines(a))
+}
+
+func TestAggregatorGaugeDelta(t *testing.T) {
+	a := newAggregator(testFormat, false, 1024, nil)
+	a.GaugeDelta("d", 1, nil)
+	a.GaugeDelta("d", 2, nil)
+	a.GaugeDelta("n", -1, nil)
+	a.Gauge("g", 5, nil)
+	a.GaugeDelta("g", -2, nil)
+	a.GaugeDelta("s", 3, nil)
+	a.Gauge("s", 1, nil)
+
+	assert.Equal(t, []string{"d:+3|g\n", "n:-1|g\n", "g:3|g\n", "s:1|g\n"}, flushLines(a))
+}
+
+func TestAggregatorSplitValues(t *testing.T) {
+	var sent []string
+	// len("h:|h\n") == 5, each value is 1 byte long
+	a := newAggregator(testFormat, true, 5+1+1+1, func(line string) { sent = append(sent, line) })
+	for i := 0; i < 5; i++ {
+		assert.True(t, a.Sample("h", "h", float64(i), nil))
+	}
+	assert.True(t, a.Sample("h2", "h", 10, nil))
+
+	// Full lines are sent as soon as a value doesn't fit
+	assert.Equal(t, []string{"h:0:1|h\n", "h:2:3|h\n"}, sent)
+	assert.Equal(t, []string{"h:4|h\n", "h2:10|h\n"}, flushLines(a))
+
+	sent = nil
+	assert.True(t, a.Sample("h", "h", 5, nil))
+	assert.True(t, a.Sample("h", "h", 6, nil))
+	assert.True(t, a.Sample("h", "h", 7, nil))
+	assert.Equal(t, []string{"h:5:6|h\n"}, sent)
+	assert.Equal(t, []string{"h:7|h\n"}, flushLines(a))
+	assert.Nil(t, flushLines(a))
+}
+
+func TestAggregatorKey(t *testing.T) {
+	a := newAggregator(testFormat, false, 1024, nil)
+	a.Count("c", 1, []string{"a,b"})
+	a.Count("c", 2, []string{"a", "b"})
+	a.Count("c", 4, []string{"a|b"})
+	a.Count("c|c", 8, nil)
+
+	assert.Equal(t, []string{"c:1|c\n", "c:2|c\n", "c:4|c\n", "c|c:8|c\n"}, flushLines(a))
+}
+
+func TestTransportAggregate(t *testing.T) {
+	w := newBlockingWriter()
+	close(w.release)
+	tr := New(w, time.Hour, Options{MaxPacketLen: 1024, Aggregate: true, Format: testFormat})
+	tr.Send("a\n")
+	tr.Aggregator().Count("c", 1, nil)
+	tr.Aggregator().Count("c", 1, nil)
+	tr.Close()
+
+	assert.Equal(t, "a\nc:2|c\n", w.String())
+}
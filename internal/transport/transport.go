@@ -0,0 +1,456 @@
+// Package transport implements the buffered packet writer shared by the
+// line-protocol senders (statsd, dogstatsd and telegraf).
+//
+// Lines are queued in a bounded channel and packed into packets by a single
+// goroutine, so the goroutine sending an observation never waits on the
+// underlying writer unless the Block policy is selected.
+package transport
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/xstats"
+)
+
+// Policy defines what happens to a line sent while the queue is full.
+type Policy int
+
+const (
+	// DropNewest discards the line being sent.
+	DropNewest Policy = iota
+	// DropOldest discards the oldest queued line to make room for the new one.
+	DropOldest
+	// Block waits until the queue has room for the line.
+	Block
+)
+
+// DefaultQueueSize is the default number of lines queued ahead of the writer.
+const DefaultQueueSize = 4096
+
+// Options configures a Transport.
+type Options struct {
+	// MaxPacketLen is the number of bytes filled before a packet is flushed
+	// before the reporting interval.
+	MaxPacketLen int
+	// QueueSize is the number of lines queued ahead of the writer.
+	QueueSize int
+	// Policy is applied to lines sent while the queue is full.
+	Policy Policy
+	// Tick returns the channel used to flush packets every report interval.
+	// Defaults to time.Tick.
+	Tick func(time.Duration) <-chan time.Time
+	// Name identifies the sender in reported errors.
+	Name string
+	// OnError is called from the transport goroutine when a packet could not
+	// be written. Defaults to logging the error with the log package.
+	OnError ErrorHandler
+	// Aggregate enables the Aggregator of the transport, flushed every
+	// report interval.
+	Aggregate bool
+	// AggregateHistograms makes the Aggregator buffer histogram-like values.
+	AggregateHistograms bool
+	// Format formats the lines written by the Aggregator.
+	Format Format
+	// Sanitizer rewrites stat names and tags, none if nil.
+	Sanitizer xstats.Sanitizer
+	// SanitizePolicy is applied to observations with an invalid name or tag.
+	SanitizePolicy xstats.SanitizePolicy
+}
+
+// Buffer holds a line formatted by a sender. Buffers are pooled: a sender
+// gets one with GetBuffer, appends a line to B and hands it over to SendBuffer.
+type Buffer struct {
+	B []byte
+}
+
+// maxPooledBufferLen is the capacity above which buffers are not put back in
+// the pool so a few large lines don't keep memory allocated.
+const maxPooledBufferLen = 1 << 12
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &Buffer{B: make([]byte, 0, 128)}
+	},
+}
+
+// GetBuffer returns an empty buffer from the pool.
+func GetBuffer() *Buffer {
+	return bufferPool.Get().(*Buffer)
+}
+
+// putBuffer resets a buffer and puts it back in the pool.
+func putBuffer(b *Buffer) {
+	if cap(b.B) > maxPooledBufferLen {
+		return
+	}
+	b.B = b.B[:0]
+	bufferPool.Put(b)
+}
+
+// ErrorHandler is called with the error returned by the writer, the number
+// of bytes of the packet lost and the name of the sender. It is also called
+// with an *xstats.InvalidValueError or an *xstats.InvalidNameError and no
+// bytes lost for rejected observations.
+type ErrorHandler func(err error, dropped int, sender string)
+
+// LogError is the default ErrorHandler, it logs errors with the log package.
+func LogError(err error, dropped int, sender string) {
+	if dropped > 0 {
+		log.Printf("error: could not write to %s: %v", sender, err)
+		return
+	}
+	log.Printf("error: %s: %v", sender, err)
+}
+
+// Transport packs lines into packets written to an io.Writer.
+type Transport struct {
+	// counters are first to keep them 64-bit aligned for atomic operations.
+	dropped      uint64
+	writeErrors  uint64
+	droppedBytes uint64
+	invalid      uint64
+
+	c            chan *Buffer
+	maxPacketLen int
+	agg          *Aggregator
+	quit         chan struct{}
+	done         chan struct{}
+	closeOnce    sync.Once
+	policy       Policy
+	name         string
+	onError      ErrorHandler
+	sanitizer    xstats.Sanitizer
+	sanitize     xstats.SanitizePolicy
+}
+
+// New creates a transport writing packets to w. Packets are flushed every
+// report interval or as soon as they reach the max packet length, whichever
+// comes first.
+func New(w io.Writer, reportInterval time.Duration, o Options) *Transport {
+	if o.QueueSize <= 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+	if o.Tick == nil {
+		o.Tick = time.Tick
+	}
+	if o.Name == "" {
+		o.Name = "statsd"
+	}
+	if o.OnError == nil {
+		o.OnError = LogError
+	}
+	t := &Transport{
+		c:            make(chan *Buffer, o.QueueSize),
+		maxPacketLen: o.MaxPacketLen,
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
+		policy:       o.Policy,
+		name:         o.Name,
+		onError:      o.OnError,
+		sanitizer:    o.Sanitizer,
+		sanitize:     o.SanitizePolicy,
+	}
+	if o.Aggregate || o.AggregateHistograms {
+		t.agg = newAggregator(o.Format, o.AggregateHistograms, o.MaxPacketLen, t.Send)
+	}
+	go t.fwd(w, o.Tick(reportInterval))
+	return t
+}
+
+// Aggregator returns the aggregator of the transport, nil if aggregation is
+// not enabled.
+func (t *Transport) Aggregator() *Aggregator {
+	return t.agg
+}
+
+// Send queues a line, applying the transport's policy if the queue is full.
+func (t *Transport) Send(line string) {
+	b := GetBuffer()
+	b.B = append(b.B, line...)
+	t.SendBuffer(b)
+}
+
+// SendBuffer queues a line held by a buffer from GetBuffer, applying the
+// transport's policy if the queue is full. The buffer is owned by the
+// transport once sent and must not be used anymore. Lines sent once the
+// transport is closed are dropped.
+func (t *Transport) SendBuffer(line *Buffer) {
+	select {
+	case <-t.quit:
+		atomic.AddUint64(&t.dropped, 1)
+		putBuffer(line)
+		return
+	default:
+	}
+	select {
+	case t.c <- line:
+		return
+	default:
+	}
+	switch t.policy {
+	case Block:
+		select {
+		case t.c <- line:
+		case <-t.quit:
+			atomic.AddUint64(&t.dropped, 1)
+			putBuffer(line)
+		}
+	case DropOldest:
+		for {
+			select {
+			case old := <-t.c:
+				atomic.AddUint64(&t.dropped, 1)
+				putBuffer(old)
+			default:
+			}
+			select {
+			case t.c <- line:
+				return
+			default:
+			}
+		}
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+		putBuffer(line)
+	}
+}
+
+// Valid returns true if value can be sent. NaN and infinite values are
+// rejected and reported to the error handler.
+func (t *Transport) Valid(stat string, value float64) bool {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		t.onError(&xstats.InvalidValueError{Stat: stat, Value: value}, 0, t.name)
+		return false
+	}
+	return true
+}
+
+// Sanitize returns the stat and tags of an observation rewritten by the
+// sanitizer, applying the sanitize policy if they are invalid. It returns
+// false if the observation must be discarded, reporting it to the error
+// handler.
+func (t *Transport) Sanitize(stat string, tags []string) (string, []string, bool) {
+	if t.sanitizer == nil {
+		return stat, tags, true
+	}
+	name, sanitized, valid := xstats.Sanitize(t.sanitizer, stat, tags)
+	if valid {
+		return stat, tags, true
+	}
+	switch t.sanitize {
+	case xstats.CountInvalid:
+		atomic.AddUint64(&t.invalid, 1)
+		return stat, tags, true
+	case xstats.RejectInvalid:
+		t.reject(stat, tags)
+		return stat, tags, false
+	}
+	return name, sanitized, true
+}
+
+// SanitizeTagPairs is like Sanitize for structured tags.
+func (t *Transport) SanitizeTagPairs(stat string, tags []xstats.Tag) (string, []xstats.Tag, bool) {
+	if t.sanitizer == nil {
+		return stat, tags, true
+	}
+	name, sanitized, valid := xstats.SanitizeTagPairs(t.sanitizer, stat, tags)
+	if valid {
+		return stat, tags, true
+	}
+	switch t.sanitize {
+	case xstats.CountInvalid:
+		atomic.AddUint64(&t.invalid, 1)
+		return stat, tags, true
+	case xstats.RejectInvalid:
+		t.reject(stat, xstats.TagStrings(tags))
+		return stat, tags, false
+	}
+	return name, sanitized, true
+}
+
+// SanitizeTags is like Sanitize for observations without a stat name, like
+// events. The stat only identifies the observation in reported errors.
+func (t *Transport) SanitizeTags(stat string, tags []string) ([]string, bool) {
+	if t.sanitizer == nil {
+		return tags, true
+	}
+	_, sanitized, valid := xstats.Sanitize(t.sanitizer, "", tags)
+	if valid {
+		return tags, true
+	}
+	switch t.sanitize {
+	case xstats.CountInvalid:
+		atomic.AddUint64(&t.invalid, 1)
+		return tags, true
+	case xstats.RejectInvalid:
+		t.reject(stat, tags)
+		return tags, false
+	}
+	return sanitized, true
+}
+
+// SanitizeValue returns the value of a set rewritten by the sanitizer if it
+// implements xstats.ValueSanitizer. Invalid values are never sent as is as
+// they would corrupt the line: they are rewritten, counted with the
+// CountInvalid policy, or rejected and reported to the error handler with
+// the RejectInvalid policy, returning false.
+func (t *Transport) SanitizeValue(stat, value string) (string, bool) {
+	vs, ok := t.sanitizer.(xstats.ValueSanitizer)
+	if !ok {
+		return value, true
+	}
+	sanitized := vs.Value(value)
+	if sanitized == value {
+		return value, true
+	}
+	switch t.sanitize {
+	case xstats.CountInvalid:
+		atomic.AddUint64(&t.invalid, 1)
+	case xstats.RejectInvalid:
+		atomic.AddUint64(&t.invalid, 1)
+		t.onError(&xstats.InvalidSetValueError{Stat: stat, Value: value}, 0, t.name)
+		return value, false
+	}
+	return sanitized, true
+}
+
+// reject counts and reports an observation with an invalid name or tag.
+func (t *Transport) reject(stat string, tags []string) {
+	atomic.AddUint64(&t.invalid, 1)
+	t.onError(&xstats.InvalidNameError{Stat: stat, Tags: tags}, 0, t.name)
+}
+
+// AppendValue appends the shortest representation of v parsing back to the
+// same value, without a decimal point for integers.
+func AppendValue(b []byte, v float64) []byte {
+	return strconv.AppendFloat(b, v, 'f', -1, 64)
+}
+
+// AppendDelta appends a gauge delta like AppendValue, with a leading plus
+// sign if it is positive so it isn't taken for an absolute value.
+func AppendDelta(b []byte, v float64) []byte {
+	if v >= 0 {
+		b = append(b, '+')
+	}
+	return AppendValue(b, v)
+}
+
+// MaxPacketLen returns the number of bytes filled before a packet is flushed.
+func (t *Transport) MaxPacketLen() int {
+	return t.maxPacketLen
+}
+
+// Dropped returns the number of lines discarded because the queue was full.
+func (t *Transport) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// WriteErrors returns the number of packets the writer failed to write.
+func (t *Transport) WriteErrors() uint64 {
+	return atomic.LoadUint64(&t.writeErrors)
+}
+
+// Invalid returns the number of observations with an invalid name or tag
+// counted or rejected.
+func (t *Transport) Invalid() uint64 {
+	return atomic.LoadUint64(&t.invalid)
+}
+
+// DroppedBytes returns the number of bytes lost with packets the writer
+// failed to write.
+func (t *Transport) DroppedBytes() uint64 {
+	return atomic.LoadUint64(&t.droppedBytes)
+}
+
+// Close flushes the queued lines and stops the transport. Closing it again
+// does nothing.
+func (t *Transport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.quit)
+		<-t.done
+		// Lines queued while closing missed the last flush
+		for {
+			select {
+			case b := <-t.c:
+				atomic.AddUint64(&t.dropped, 1)
+				putBuffer(b)
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+func (t *Transport) fwd(w io.Writer, tick <-chan time.Time) {
+	maxPacketLen := t.maxPacketLen
+	defer close(t.done)
+
+	buf := &bytes.Buffer{}
+	write := func(m []byte) {
+		newLen := buf.Len() + len(m)
+		if newLen > maxPacketLen {
+			t.flush(w, buf)
+		}
+
+		buf.Write(m)
+
+		if newLen == maxPacketLen {
+			t.flush(w, buf)
+		}
+	}
+	send := func(b *Buffer) {
+		write(b.B)
+		putBuffer(b)
+	}
+	writeString := func(m string) {
+		write([]byte(m))
+	}
+	// drain writes the lines queued and aggregated so far so they make it in
+	// the next flush.
+	drain := func() {
+		for n := len(t.c); n > 0; n-- {
+			select {
+			case b := <-t.c:
+				send(b)
+			default:
+				n = 0
+			}
+		}
+		if t.agg != nil {
+			t.agg.flush(writeString)
+		}
+	}
+	for {
+		select {
+		case b := <-t.c:
+			send(b)
+		case <-tick:
+			drain()
+			t.flush(w, buf)
+		case <-t.quit:
+			drain()
+			t.flush(w, buf)
+			return
+		}
+	}
+}
+
+func (t *Transport) flush(w io.Writer, buf *bytes.Buffer) {
+	if buf.Len() <= 0 {
+		return
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		atomic.AddUint64(&t.writeErrors, 1)
+		atomic.AddUint64(&t.droppedBytes, uint64(buf.Len()))
+		t.onError(err, buf.Len(), t.name)
+	}
+	buf.Reset()
+}
@@ -0,0 +1,173 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingWriter blocks every write until release is closed.
+type blockingWriter struct {
+	sync.Mutex
+	buf     bytes.Buffer
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingWriter() *blockingWriter {
+	return &blockingWriter{
+		entered: make(chan struct{}, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.entered <- struct{}{}
+	<-w.release
+	w.Lock()
+	defer w.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.Lock()
+	defer w.Unlock()
+	return w.buf.String()
+}
+
+// stall sends a first line filling a whole packet and waits for the
+// transport to be stuck writing it.
+func stall(t *Transport, w *blockingWriter) {
+	t.Send("a\n")
+	<-w.entered
+}
+
+func newStalled(p Policy) (*Transport, *blockingWriter) {
+	w := newBlockingWriter()
+	t := New(w, time.Hour, Options{MaxPacketLen: 2, QueueSize: 1, Policy: p})
+	stall(t, w)
+	return t, w
+}
+
+func TestDropNewest(t *testing.T) {
+	tr, w := newStalled(DropNewest)
+	tr.Send("b\n")
+	tr.Send("c\n")
+	assert.Equal(t, uint64(1), tr.Dropped())
+	close(w.release)
+	tr.Close()
+	assert.Equal(t, "a\nb\n", w.String())
+}
+
+func TestDropOldest(t *testing.T) {
+	tr, w := newStalled(DropOldest)
+	tr.Send("b\n")
+	tr.Send("c\n")
+	assert.Equal(t, uint64(1), tr.Dropped())
+	close(w.release)
+	tr.Close()
+	assert.Equal(t, "a\nc\n", w.String())
+}
+
+func TestBlock(t *testing.T) {
+	tr, w := newStalled(Block)
+	tr.Send("b\n")
+	sent := make(chan struct{})
+	go func() {
+		tr.Send("c\n")
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("send did not block")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(w.release)
+	<-sent
+	tr.Close()
+	assert.Equal(t, uint64(0), tr.Dropped())
+	assert.Equal(t, "a\nb\nc\n", w.String())
+}
+
+func TestCloseFlushesQueue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tr := New(buf, time.Hour, Options{MaxPacketLen: 1 << 15})
+	tr.Send("a\n")
+	tr.Send("b\n")
+	tr.Close()
+	assert.Equal(t, "a\nb\n", buf.String())
+}
+
+func TestSendAfterClose(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tr := New(buf, time.Hour, Options{MaxPacketLen: 1 << 15})
+	tr.Send("a\n")
+	tr.Close()
+	tr.Send("b\n")
+	assert.NoError(t, tr.Close())
+	assert.Equal(t, "a\n", buf.String())
+	assert.Equal(t, uint64(1), tr.Dropped())
+}
+
+type errWriter struct{}
+
+func (w errWriter) Write(p []byte) (n int, err error) {
+	return 0, errors.New("i/o error")
+}
+
+func TestOnError(t *testing.T) {
+	var gotErr error
+	var gotDropped int
+	var gotSender string
+	tr := New(errWriter{}, time.Hour, Options{
+		MaxPacketLen: 1 << 15,
+		Name:         "test",
+		OnError: func(err error, dropped int, sender string) {
+			gotErr, gotDropped, gotSender = err, dropped, sender
+		},
+	})
+	tr.Send("a\n")
+	tr.Send("bc\n")
+	tr.Close()
+	assert.EqualError(t, gotErr, "i/o error")
+	assert.Equal(t, 5, gotDropped)
+	assert.Equal(t, "test", gotSender)
+	assert.Equal(t, uint64(1), tr.WriteErrors())
+	assert.Equal(t, uint64(5), tr.DroppedBytes())
+}
+
+func TestLogError(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+
+	LogError(errors.New("i/o error"), 5, "dogstatsd")
+	LogError(&xstats.InvalidNameError{Stat: "metric"}, 0, "telegraf")
+	assert.Equal(t, "error: could not write to dogstatsd: i/o error\n"+
+		"error: telegraf: xstats: invalid name or tags for metric\n", buf.String())
+}
+
+func BenchmarkSendBuffer(b *testing.B) {
+	tr := New(ioutil.Discard, time.Hour, Options{MaxPacketLen: 1432, Policy: Block})
+	defer tr.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf := GetBuffer()
+		buf.B = append(buf.B, "metric1:1|c\n"...)
+		tr.SendBuffer(buf)
+	}
+}
@@ -0,0 +1,69 @@
+// Package uniq counts unique values per interval, emulating the statsd set
+// metric type for backends without native support.
+package uniq
+
+import (
+	"sync"
+	"time"
+)
+
+// Counter counts the unique values added during fixed intervals. It reports
+// the count of the last completed interval, like a statsd server reports sets
+// on each flush.
+type Counter struct {
+	interval time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	start time.Time
+	cur   map[string]struct{}
+	last  int
+}
+
+// New creates a counter reset every interval.
+func New(interval time.Duration) *Counter {
+	return NewClock(interval, time.Now)
+}
+
+// NewClock creates a counter reset every interval using the given clock.
+func NewClock(interval time.Duration, now func() time.Time) *Counter {
+	return &Counter{
+		interval: interval,
+		now:      now,
+		start:    now(),
+		cur:      map[string]struct{}{},
+	}
+}
+
+// Add adds a value to the current interval.
+func (c *Counter) Add(v string) {
+	c.mu.Lock()
+	c.roll()
+	c.cur[v] = struct{}{}
+	c.mu.Unlock()
+}
+
+// Count returns the number of unique values added during the last completed
+// interval.
+func (c *Counter) Count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roll()
+	return c.last
+}
+
+// roll starts a new interval if the current one is over.
+func (c *Counter) roll() {
+	elapsed := c.now().Sub(c.start)
+	if elapsed < c.interval {
+		return
+	}
+	if elapsed < 2*c.interval {
+		c.last = len(c.cur)
+	} else {
+		// No value was added during the last completed interval
+		c.last = 0
+	}
+	c.start = c.start.Add(elapsed - elapsed%c.interval)
+	c.cur = map[string]struct{}{}
+}
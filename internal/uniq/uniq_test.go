@@ -0,0 +1,29 @@
+package uniq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounter(t *testing.T) {
+	now := time.Now()
+	c := NewClock(10*time.Second, func() time.Time { return now })
+
+	c.Add("a")
+	c.Add("b")
+	c.Add("a")
+	assert.Equal(t, 0, c.Count())
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, 2, c.Count())
+	c.Add("c")
+	assert.Equal(t, 2, c.Count())
+
+	now = now.Add(15 * time.Second)
+	assert.Equal(t, 1, c.Count())
+
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, 0, c.Count())
+}
@@ -0,0 +1,5 @@
+// +build !xstatsdebug
+
+package xstats
+
+const debugBuild = false
@@ -16,6 +16,33 @@ func (rc *nopS) GetTags() []string {
 	return nil
 }
 
+// SetTag implements XStats interface
+func (rc *nopS) SetTag(key, value string) {
+}
+
+// StartTimer implements XStats interface
+func (rc *nopS) StartTimer(stat string, tags ...string) Timer {
+	return startTimer(rc, stat, tags)
+}
+
+// TimeFunc implements XStats interface
+func (rc *nopS) TimeFunc(stat string, f func(), tags ...string) {
+	f()
+}
+
+// With implements XStats interface
+func (rc *nopS) With(opts ...Option) XStater {
+	return rc
+}
+
+// RemoveTags implements XStats interface
+func (rc *nopS) RemoveTags(keys ...string) {
+}
+
+// AddTagPairs implements XStats interface
+func (rc *nopS) AddTagPairs(tags ...Tag) {
+}
+
 // Gauge implements XStats interface
 func (rc *nopS) Gauge(stat string, value float64, tags ...string) {
 }
@@ -31,3 +58,51 @@ func (rc *nopS) Histogram(stat string, value float64, tags ...string) {
 // Timing implements XStats interface
 func (rc *nopS) Timing(stat string, duration time.Duration, tags ...string) {
 }
+
+// GaugeT implements XStats interface
+func (rc *nopS) GaugeT(stat string, value float64, tags ...Tag) {
+}
+
+// CountT implements XStats interface
+func (rc *nopS) CountT(stat string, count float64, tags ...Tag) {
+}
+
+// HistogramT implements XStats interface
+func (rc *nopS) HistogramT(stat string, value float64, tags ...Tag) {
+}
+
+// TimingT implements XStats interface
+func (rc *nopS) TimingT(stat string, duration time.Duration, tags ...Tag) {
+}
+
+// CountSampled implements XStats interface
+func (rc *nopS) CountSampled(stat string, count float64, rate float64, tags ...string) {
+}
+
+// HistogramSampled implements XStats interface
+func (rc *nopS) HistogramSampled(stat string, value float64, rate float64, tags ...string) {
+}
+
+// TimingSampled implements XStats interface
+func (rc *nopS) TimingSampled(stat string, duration time.Duration, rate float64, tags ...string) {
+}
+
+// GaugeDelta implements XStats interface
+func (rc *nopS) GaugeDelta(stat string, delta float64, tags ...string) {
+}
+
+// Set implements XStats interface
+func (rc *nopS) Set(stat string, value string, tags ...string) {
+}
+
+// Distribution implements XStats interface
+func (rc *nopS) Distribution(stat string, value float64, tags ...string) {
+}
+
+// Event implements XStats interface
+func (rc *nopS) Event(e Event) {
+}
+
+// ServiceCheck implements XStats interface
+func (rc *nopS) ServiceCheck(sc ServiceCheck) {
+}
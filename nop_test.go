@@ -11,4 +11,28 @@ func TestNop(t *testing.T) {
 	nop.Count("metric", 1)
 	nop.Histogram("metric", 1)
 	nop.Timing("metric", 1*time.Second)
+	nop.AddTagPairs(Tag{"key", "value"})
+	nop.SetTag("key", "value")
+	nop.RemoveTags("key")
+	nop.GaugeT("metric", 1)
+	nop.CountT("metric", 1)
+	nop.HistogramT("metric", 1)
+	nop.TimingT("metric", 1*time.Second)
+	nop.CountSampled("metric", 1, 0.5)
+	nop.HistogramSampled("metric", 1, 0.5)
+	nop.TimingSampled("metric", 1*time.Second, 0.5)
+	nop.Set("metric", "value")
+	nop.GaugeDelta("metric", -1)
+	nop.Distribution("metric", 1)
+	nop.Event(Event{Title: "event"})
+	nop.ServiceCheck(ServiceCheck{Name: "check"})
+	nop.StartTimer("metric").Stop()
+	called := false
+	nop.TimeFunc("metric", func() { called = true })
+	if !called {
+		t.Error("TimeFunc did not call f")
+	}
+	if nop.With(WithTags("tag")) != nop {
+		t.Error("With did not return nop")
+	}
 }
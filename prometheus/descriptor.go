@@ -0,0 +1,76 @@
+package prometheus
+
+import (
+	"path"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Descriptor describes the metrics of a stat, applied when the first
+// observation of the stat creates its metric.
+type Descriptor struct {
+	// Help is the help text of the metric, the metric name if empty.
+	Help string
+	// Unit is appended to the metric name with an underscore, like "bytes",
+	// unless the name already ends with it. Timings are always in seconds.
+	Unit string
+	// Buckets are the upper bounds of the buckets of histograms and timings,
+	// like the ones returned by prometheus.LinearBuckets or
+	// prometheus.ExponentialBuckets. Defaults to the Buckets option.
+	Buckets []float64
+	// ConstLabels are added to all the series of the metric.
+	ConstLabels prometheus.Labels
+}
+
+// glob is a descriptor of the stats matching a pattern.
+type glob struct {
+	pattern string
+	d       Descriptor
+}
+
+// Describe sets the descriptor of the stats with the given name, or matching
+// the given pattern with the syntax of path.Match, like "http_*". Names and
+// patterns are matched against the sanitized stat. A descriptor set for the
+// exact name of a stat wins over patterns, which are tried in order.
+func Describe(pattern string, d Descriptor) Option {
+	return func(s *sender) {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			if s.descriptors == nil {
+				s.descriptors = make(map[string]Descriptor)
+			}
+			s.descriptors[pattern] = d
+			return
+		}
+		s.globs = append(s.globs, glob{pattern, d})
+	}
+}
+
+// descriptor returns the descriptor of the metric name of a stat, with the
+// defaults filled in.
+func (s *sender) descriptor(name, stat string) Descriptor {
+	d, ok := s.descriptors[stat]
+	if !ok {
+		for _, g := range s.globs {
+			if matched, _ := path.Match(g.pattern, stat); matched {
+				d = g.d
+				break
+			}
+		}
+	}
+	if d.Help == "" {
+		d.Help = name
+	}
+	if d.Buckets == nil {
+		d.Buckets = s.bucketsFor(stat)
+	}
+	return d
+}
+
+// withUnit returns name with the unit suffix.
+func withUnit(name, unit string) string {
+	if unit == "" || strings.HasSuffix(name, "_"+unit) {
+		return name
+	}
+	return name + "_" + unit
+}
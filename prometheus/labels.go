@@ -0,0 +1,150 @@
+package prometheus
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LabelPolicy defines what happens to an observation whose tags don't match
+// the labels of its metric, set by the first observation of the metric.
+type LabelPolicy int
+
+const (
+	// UnionLabels sends the observation with the union of the labels of the
+	// metric and of its tags, the missing labels being sent empty, which
+	// Prometheus handles like absent labels. The series of each label set
+	// are collected with their own labels; only the first label set is
+	// registered, so registries with pedantic checks reject the others.
+	UnionLabels LabelPolicy = iota
+	// ProjectLabels sends the observation with the labels of the metric,
+	// the missing labels being sent empty and the tags without a label
+	// dropped.
+	ProjectLabels
+	// DropMismatched discards the observation.
+	DropMismatched
+	// SplitMismatched sends the observation to a metric with its own labels,
+	// named after the stat followed by "_by_" and the sorted label names
+	// joined with underscores, or "_unlabeled" if it has no tags, and by the
+	// "_seconds" unit for timings.
+	SplitMismatched
+)
+
+// OnLabelMismatch sets the policy applied to observations whose tags don't
+// match the labels of their metric, UnionLabels by default. They are counted
+// whatever the policy.
+func OnLabelMismatch(p LabelPolicy) Option {
+	return func(s *sender) {
+		s.labelPolicy = p
+	}
+}
+
+// labelSet is a collector with the names of its labels.
+type labelSet struct {
+	c    prometheus.Collector
+	keys []string
+}
+
+// union returns the collector of the first label set of v holding all the
+// non-empty tags of an observation, and the label values of the observation
+// in the order of its labels. If none does, it adds a label set with the
+// labels of the last one and the missing tags, so each series belongs to a
+// single label set.
+func (v *vec) union(keys, values []string) (prometheus.Collector, []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if covers(v.keys, keys, values) {
+		lv, _ := labelValues(v.keys, keys, values)
+		return v.c, lv
+	}
+	last := v.keys
+	for _, ls := range v.widened {
+		if covers(ls.keys, keys, values) {
+			lv, _ := labelValues(ls.keys, keys, values)
+			return ls.c, lv
+		}
+		last = ls.keys
+	}
+	widened := append([]string(nil), last...)
+	for i, k := range keys {
+		if values[i] != "" && !contains(widened, k) {
+			widened = append(widened, k)
+		}
+	}
+	ls := labelSet{v.create(widened), widened}
+	v.widened = append(v.widened, ls)
+	lv, _ := labelValues(ls.keys, keys, values)
+	return ls.c, lv
+}
+
+// covers returns true if labels hold the keys of all the non-empty values.
+func covers(labels, keys, values []string) bool {
+	for i, k := range keys {
+		if values[i] != "" && !contains(labels, k) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains returns true if a holds s.
+func contains(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// labelValues returns the values of the labels of a metric for an
+// observation with the given tag keys and values, in the order of labels.
+// Missing labels are empty. It returns false if the tag keys are not the
+// labels of the metric.
+func labelValues(labels, keys, values []string) ([]string, bool) {
+	if equal(labels, keys) {
+		return values, true
+	}
+	lv := make([]string, len(labels))
+	found := 0
+	for i, l := range labels {
+		for j, k := range keys {
+			if k == l {
+				lv[i] = values[j]
+				found++
+				break
+			}
+		}
+	}
+	return lv, found == len(labels) && found == len(keys)
+}
+
+// equal returns true if a and b hold the same strings in the same order.
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitName returns the name of the metric of a stat observed with the given
+// label names under the SplitMismatched policy. The suffix is added before the
+// "_seconds" unit of timings so the unit stays last.
+func splitName(name string, keys []string) string {
+	unit := ""
+	if strings.HasSuffix(name, "_seconds") {
+		name, unit = strings.TrimSuffix(name, "_seconds"), "_seconds"
+	}
+	if len(keys) == 0 {
+		return name + "_unlabeled" + unit
+	}
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	return name + "_by_" + strings.Join(sorted, "_") + unit
+}
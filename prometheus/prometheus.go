@@ -1,27 +1,78 @@
 package prometheus
 
 import (
+	"log"
 	"net/http"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/xstats"
 )
 
 type sender struct {
+	// counters are first to keep them 64-bit aligned for atomic operations.
+	invalid        uint64
+	negative       uint64
+	registerErrors uint64
+	mismatches     uint64
+	overflows      uint64
+
 	http.Handler
 
-	counters   map[string]*prometheus.CounterVec
-	gauges     map[string]*prometheus.GaugeVec
-	histograms map[string]*prometheus.HistogramVec
+	counters   map[string]*vec
+	gauges     map[string]*vec
+	histograms map[string]*vec
+	timings    map[string]*vec
+	sets       map[string]*vec
 	sync.RWMutex
+
+	registerer  prometheus.Registerer
+	namespace   string
+	subsystem   string
+	onError     func(err error)
+	sanitizer   xstats.Sanitizer
+	policy      xstats.SanitizePolicy
+	labelPolicy LabelPolicy
+	buckets     []buckets
+	objectives  map[float64]float64
+	descriptors map[string]Descriptor
+	globs       []glob
+	ttl         time.Duration
+	maxSeries   int
+	overflow    *prometheus.CounterVec
+}
+
+// buckets holds the bucket layout of the histograms with a name prefix.
+type buckets struct {
+	prefix  string
+	buckets []float64
+}
+
+// vec is a registered metric vector with the names of its labels, tracking
+// its series to expire or limit them.
+type vec struct {
+	c      prometheus.Collector
+	keys   []string
+	name   string
+	ttl    time.Duration
+	max    int
+	create func(keys []string) prometheus.Collector
+
+	mu     sync.Mutex
+	series map[string]*series
+	// widened holds the collectors of the label sets added by the
+	// UnionLabels policy, each one adding labels to the previous one.
+	widened []labelSet
 }
 
 // New creates a prometheus publisher at the given HTTP address.
-func New(addr string) xstats.Sender {
-	s := NewHandler()
+func New(addr string, opts ...Option) xstats.Sender {
+	s := NewHandler(opts...)
 	go func() {
 		http.ListenAndServe(addr, s)
 	}()
@@ -29,86 +80,592 @@ func New(addr string) xstats.Sender {
 }
 
 // NewHandler creates a prometheus publisher - a http.Handler and an xstats.Sender.
-func NewHandler() *sender {
-	return &sender{
-		Handler:    prometheus.Handler(),
-		counters:   make(map[string]*prometheus.CounterVec),
-		gauges:     make(map[string]*prometheus.GaugeVec),
-		histograms: make(map[string]*prometheus.HistogramVec),
+// Metrics are registered with the global prometheus registry, served by the
+// global prometheus handler.
+//
+// The returned sender implements interface{ Stats() Stats } to report the
+// observations with an invalid name or tag, the negative counts and the
+// metrics which could not be registered.
+//
+// Prometheus counters can only increase: negative counts are discarded and
+// counted. Use GaugeDelta for values going both ways.
+func NewHandler(opts ...Option) *sender {
+	s := newSender(prometheus.DefaultRegisterer, opts)
+	s.Handler = prometheus.Handler()
+	return s
+}
+
+// NewHandlerFor is like NewHandler, registering the metrics with reg and
+// serving the metrics gathered from g. Senders sharing a registry share the
+// metrics with the same name and type.
+func NewHandlerFor(reg prometheus.Registerer, g prometheus.Gatherer, opts ...Option) *sender {
+	s := newSender(reg, opts)
+	s.Handler = promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+	return s
+}
+
+func newSender(reg prometheus.Registerer, opts []Option) *sender {
+	s := &sender{
+		counters:   make(map[string]*vec),
+		gauges:     make(map[string]*vec),
+		histograms: make(map[string]*vec),
+		timings:    make(map[string]*vec),
+		sets:       make(map[string]*vec),
+		registerer: reg,
+		onError:    logError,
+		sanitizer:  Sanitizer{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.maxSeries > 0 {
+		if c := s.register(newOverflow(s)); c != nil {
+			s.overflow = c.(*prometheus.CounterVec)
+		}
 	}
+	return s
+}
+
+// logError is the default error handler, it logs errors with the log package.
+func logError(err error) {
+	log.Printf("error: prometheus: %v", err)
+}
+
+// Option configures a sender created with New or NewHandler.
+type Option func(*sender)
+
+// Namespace sets the namespace prepended to the metric names, joined with an
+// underscore.
+func Namespace(namespace string) Option {
+	return func(s *sender) {
+		s.namespace = namespace
+	}
+}
+
+// Subsystem sets the subsystem prepended to the metric names after the
+// namespace, joined with an underscore.
+func Subsystem(subsystem string) Option {
+	return func(s *sender) {
+		s.subsystem = subsystem
+	}
+}
+
+// OnError sets the handler called with the errors returned when registering
+// a metric, like a metric registered with another type by another sender
+// sharing the registry, or when sending an observation, like a tag value
+// which is not valid UTF-8. The observations of a metric which could not be
+// registered are discarded. Defaults to logging the error with the log
+// package.
+func OnError(h func(err error)) Option {
+	return func(s *sender) {
+		s.onError = h
+	}
+}
+
+// Buckets sets the upper bounds of the buckets of the histograms and timings
+// whose name starts with prefix, matched against the sanitized stat. The
+// longest matching prefix is used, and DefBuckets if none matches.
+func Buckets(prefix string, upperBounds ...float64) Option {
+	return func(s *sender) {
+		s.buckets = append(s.buckets, buckets{prefix, upperBounds})
+	}
+}
+
+// TimingSummary makes timings recorded into summaries with the given
+// quantile objectives, mapping quantiles to their allowed error, instead of
+// histograms.
+func TimingSummary(objectives map[float64]float64) Option {
+	return func(s *sender) {
+		s.objectives = objectives
+	}
+}
+
+// Sanitize sets the sanitizer rewriting stat names and tags, Sanitizer by
+// default. A nil sanitizer disables sanitization, metrics with an invalid
+// name fail to register.
+func Sanitize(sanitizer xstats.Sanitizer) Option {
+	return func(s *sender) {
+		s.sanitizer = sanitizer
+	}
+}
+
+// OnInvalidName sets the policy applied to observations with a name or tag
+// changed by the sanitizer. Counted observations are sent as is, so metrics
+// with an invalid name fail to register.
+func OnInvalidName(p xstats.SanitizePolicy) Option {
+	return func(s *sender) {
+		s.policy = p
+	}
+}
+
+// Stats holds the counters of a sender.
+type Stats struct {
+	// InvalidNames is the number of observations with an invalid name or tag
+	// counted or rejected.
+	InvalidNames uint64
+	// NegativeCounts is the number of counts discarded because they were
+	// negative.
+	NegativeCounts uint64
+	// RegisterErrors is the number of metrics which failed to register.
+	RegisterErrors uint64
+	// LabelMismatches is the number of observations with tags not matching
+	// the labels of their metric.
+	LabelMismatches uint64
+	// SeriesOverflows is the number of observations discarded because their
+	// metric reached the series limit.
+	SeriesOverflows uint64
+}
+
+// Stats returns the sender's counters.
+func (s *sender) Stats() Stats {
+	return Stats{
+		InvalidNames:    atomic.LoadUint64(&s.invalid),
+		NegativeCounts:  atomic.LoadUint64(&s.negative),
+		RegisterErrors:  atomic.LoadUint64(&s.registerErrors),
+		LabelMismatches: atomic.LoadUint64(&s.mismatches),
+		SeriesOverflows: atomic.LoadUint64(&s.overflows),
+	}
+}
+
+// sanitize returns the stat and tags of an observation rewritten by the
+// sanitizer, applying the sanitize policy if they are invalid. It returns
+// false if the observation must be discarded.
+func (s *sender) sanitize(stat string, tags []string) (string, []string, bool) {
+	if s.sanitizer == nil {
+		return stat, tags, true
+	}
+	name, sanitized, valid := xstats.Sanitize(s.sanitizer, stat, tags)
+	if valid {
+		return stat, tags, true
+	}
+	switch s.policy {
+	case xstats.CountInvalid:
+		atomic.AddUint64(&s.invalid, 1)
+		return stat, tags, true
+	case xstats.RejectInvalid:
+		atomic.AddUint64(&s.invalid, 1)
+		return stat, tags, false
+	}
+	return name, sanitized, true
+}
+
+// sanitizeTagPairs is like sanitize for structured tags.
+func (s *sender) sanitizeTagPairs(stat string, tags []xstats.Tag) (string, []xstats.Tag, bool) {
+	if s.sanitizer == nil {
+		return stat, tags, true
+	}
+	name, sanitized, valid := xstats.SanitizeTagPairs(s.sanitizer, stat, tags)
+	if valid {
+		return stat, tags, true
+	}
+	switch s.policy {
+	case xstats.CountInvalid:
+		atomic.AddUint64(&s.invalid, 1)
+		return stat, tags, true
+	case xstats.RejectInvalid:
+		atomic.AddUint64(&s.invalid, 1)
+		return stat, tags, false
+	}
+	return name, sanitized, true
 }
 
 // Gauge implements xstats.Sender interface
 //
 // Mark the tags as "key:value".
 func (s *sender) Gauge(stat string, value float64, tags ...string) {
-	s.RLock()
-	m, ok := s.gauges[stat]
-	s.RUnlock()
-	keys, values := splitTags(tags)
+	stat, tags, ok := s.sanitize(stat, tags)
 	if !ok {
-		s.Lock()
-		if m, ok = s.gauges[stat]; !ok {
-			m = prometheus.NewGaugeVec(
-				prometheus.GaugeOpts{Name: stat, Help: stat},
-				keys)
-			prometheus.MustRegister(m)
-			s.gauges[stat] = m
-		}
-		s.Unlock()
+		return
+	}
+	keys, values := splitTags(tags)
+	if m := s.gauge(stat, keys, values); m != nil {
+		m.Set(value)
 	}
-	m.WithLabelValues(values...).Set(value)
 }
 
 // Count implements xstats.Sender interface
 //
 // Mark the tags as "key:value".
 func (s *sender) Count(stat string, count float64, tags ...string) {
-	s.RLock()
-	m, ok := s.counters[stat]
-	s.RUnlock()
+	stat, tags, ok := s.sanitize(stat, tags)
+	if !ok || !s.monotonic(count) {
+		return
+	}
 	keys, values := splitTags(tags)
+	if m := s.counter(stat, keys, values); m != nil {
+		m.Add(count)
+	}
+}
+
+// monotonic returns true if count can be added to a counter, counting the
+// negative counts.
+func (s *sender) monotonic(count float64) bool {
+	if count < 0 {
+		atomic.AddUint64(&s.negative, 1)
+		return false
+	}
+	return true
+}
+
+// GaugeDelta implements xstats.GaugeDeltaSender interface
+//
+// Mark the tags as "key:value".
+func (s *sender) GaugeDelta(stat string, delta float64, tags ...string) {
+	stat, tags, ok := s.sanitize(stat, tags)
 	if !ok {
-		s.Lock()
-		if m, ok = s.counters[stat]; !ok {
-			m = prometheus.NewCounterVec(
-				prometheus.CounterOpts{Name: stat, Help: stat},
-				keys)
-			prometheus.MustRegister(m)
-			s.counters[stat] = m
-		}
-		s.Unlock()
+		return
+	}
+	keys, values := splitTags(tags)
+	if m := s.gauge(stat, keys, values); m != nil {
+		m.Add(delta)
 	}
-	m.WithLabelValues(values...).Add(count)
 }
 
 // Histogram implements xstats.Sender interface
 //
 // Mark the tags as "key:value".
 func (s *sender) Histogram(stat string, value float64, tags ...string) {
+	stat, tags, ok := s.sanitize(stat, tags)
+	if !ok {
+		return
+	}
+	keys, values := splitTags(tags)
+	if m := s.histogram(stat, keys, values); m != nil {
+		m.Observe(value)
+	}
+}
+
+// Timing implements xstats.Sender interface - records the duration in seconds
+// in a histogram, or a summary with the TimingSummary option, named after
+// the stat with a "_seconds" suffix.
+//
+// Mark the tags as "key:value".
+func (s *sender) Timing(stat string, duration time.Duration, tags ...string) {
+	stat, tags, ok := s.sanitize(stat, tags)
+	if !ok {
+		return
+	}
+	keys, values := splitTags(tags)
+	if m := s.timing(stat, keys, values); m != nil {
+		m.Observe(duration.Seconds())
+	}
+}
+
+// GaugeT implements xstats.TagSender interface
+func (s *sender) GaugeT(stat string, value float64, tags ...xstats.Tag) {
+	stat, tags, ok := s.sanitizeTagPairs(stat, tags)
+	if !ok {
+		return
+	}
+	keys, values := splitTagPairs(tags)
+	if m := s.gauge(stat, keys, values); m != nil {
+		m.Set(value)
+	}
+}
+
+// CountT implements xstats.TagSender interface
+func (s *sender) CountT(stat string, count float64, tags ...xstats.Tag) {
+	stat, tags, ok := s.sanitizeTagPairs(stat, tags)
+	if !ok || !s.monotonic(count) {
+		return
+	}
+	keys, values := splitTagPairs(tags)
+	if m := s.counter(stat, keys, values); m != nil {
+		m.Add(count)
+	}
+}
+
+// HistogramT implements xstats.TagSender interface
+func (s *sender) HistogramT(stat string, value float64, tags ...xstats.Tag) {
+	stat, tags, ok := s.sanitizeTagPairs(stat, tags)
+	if !ok {
+		return
+	}
+	keys, values := splitTagPairs(tags)
+	if m := s.histogram(stat, keys, values); m != nil {
+		m.Observe(value)
+	}
+}
+
+// TimingT implements xstats.TagSender interface - records the duration like
+// Timing.
+func (s *sender) TimingT(stat string, duration time.Duration, tags ...xstats.Tag) {
+	stat, tags, ok := s.sanitizeTagPairs(stat, tags)
+	if !ok {
+		return
+	}
+	keys, values := splitTagPairs(tags)
+	if m := s.timing(stat, keys, values); m != nil {
+		m.Observe(duration.Seconds())
+	}
+}
+
+// gauge returns the gauge of a stat with the label values, registering it
+// on first use. It returns nil if the observation must be discarded.
+func (s *sender) gauge(stat string, keys, values []string) prometheus.Gauge {
+	c, values := s.vec(s.gauges, stat, stat, keys, values, newGauge)
+	if c == nil {
+		return nil
+	}
+	g, err := c.(*prometheus.GaugeVec).GetMetricWithLabelValues(values...)
+	if err != nil {
+		s.fail(err)
+		return nil
+	}
+	return g
+}
+
+// counter returns the counter of a stat with the label values, registering
+// it on first use. It returns nil if the observation must be discarded.
+func (s *sender) counter(stat string, keys, values []string) prometheus.Counter {
+	v, values := s.vec(s.counters, stat, stat, keys, values, newCounter)
+	if v == nil {
+		return nil
+	}
+	c, err := v.(*prometheus.CounterVec).GetMetricWithLabelValues(values...)
+	if err != nil {
+		s.fail(err)
+		return nil
+	}
+	return c
+}
+
+// histogram returns the histogram of a stat with the label values,
+// registering it on first use. It returns nil if the observation must be
+// discarded.
+func (s *sender) histogram(stat string, keys, values []string) prometheus.Observer {
+	if s.reserved(stat, keys, "le") {
+		return nil
+	}
+	c, values := s.vec(s.histograms, stat, stat, keys, values, newHistogram)
+	if c == nil {
+		return nil
+	}
+	h, err := c.(*prometheus.HistogramVec).GetMetricWithLabelValues(values...)
+	if err != nil {
+		s.fail(err)
+		return nil
+	}
+	return h
+}
+
+// timing returns the histogram or summary of the timings of a stat with the
+// label values, registering it on first use. It returns nil if the
+// observation must be discarded.
+func (s *sender) timing(stat string, keys, values []string) prometheus.Observer {
+	name := stat
+	if strings.HasSuffix(stat, "_seconds") {
+		stat = strings.TrimSuffix(stat, "_seconds")
+	} else {
+		name += "_seconds"
+	}
+	label := "le"
+	if s.objectives != nil {
+		label = "quantile"
+	}
+	if s.reserved(stat, keys, label) {
+		return nil
+	}
+	c, values := s.vec(s.timings, name, stat, keys, values, newTiming)
+	if c == nil {
+		return nil
+	}
+	var o prometheus.Observer
+	var err error
+	switch v := c.(type) {
+	case *prometheus.SummaryVec:
+		o, err = v.GetMetricWithLabelValues(values...)
+	case *prometheus.HistogramVec:
+		o, err = v.GetMetricWithLabelValues(values...)
+	}
+	if err != nil {
+		s.fail(err)
+		return nil
+	}
+	return o
+}
+
+// reserved returns true if keys hold label, which prometheus reserves for the
+// buckets of histograms or the quantiles of summaries, reporting the
+// observation as invalid.
+func (s *sender) reserved(stat string, keys []string, label string) bool {
+	for _, k := range keys {
+		if k == label {
+			s.fail(&xstats.InvalidNameError{Stat: stat, Tags: []string{k}})
+			return true
+		}
+	}
+	return false
+}
+
+// bucketsFor returns the bucket upper bounds of the histogram of a stat, nil
+// for the default buckets.
+func (s *sender) bucketsFor(stat string) []float64 {
+	var match buckets
+	for _, b := range s.buckets {
+		prefix := b.prefix
+		if s.sanitizer != nil {
+			prefix = s.sanitizer.Name(prefix)
+		}
+		if strings.HasPrefix(stat, prefix) && len(prefix) >= len(match.prefix) {
+			match = buckets{prefix, b.buckets}
+		}
+	}
+	return match.buckets
+}
+
+func newGauge(s *sender, name string, d Descriptor, keys []string) prometheus.Collector {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Namespace: s.namespace, Subsystem: s.subsystem, Name: withUnit(name, d.Unit),
+			Help: d.Help, ConstLabels: d.ConstLabels},
+		keys)
+}
+
+func newCounter(s *sender, name string, d Descriptor, keys []string) prometheus.Collector {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{Namespace: s.namespace, Subsystem: s.subsystem, Name: withUnit(name, d.Unit),
+			Help: d.Help, ConstLabels: d.ConstLabels},
+		keys)
+}
+
+func newHistogram(s *sender, name string, d Descriptor, keys []string) prometheus.Collector {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Namespace: s.namespace, Subsystem: s.subsystem, Name: withUnit(name, d.Unit),
+			Help: d.Help, ConstLabels: d.ConstLabels, Buckets: d.Buckets},
+		keys)
+}
+
+func newTiming(s *sender, name string, d Descriptor, keys []string) prometheus.Collector {
+	// Timings are always in seconds, name already has the unit
+	d.Unit = ""
+	if s.objectives != nil {
+		return prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{Namespace: s.namespace, Subsystem: s.subsystem, Name: name,
+				Help: d.Help, ConstLabels: d.ConstLabels, Objectives: s.objectives},
+			keys)
+	}
+	return newHistogram(s, name, d, keys)
+}
+
+func newSet(s *sender, name string, d Descriptor, keys []string) prometheus.Collector {
+	name = prometheus.BuildFQName(s.namespace, s.subsystem, withUnit(name, d.Unit))
+	return newSetCollector(name, d.Help, keys, d.ConstLabels)
+}
+
+// vec returns the collector of a metric for an observation with the given
+// labels and the label values in the order of the collector labels, applying
+// the label policy if they don't match. The metric is described by the
+// descriptor of stat. It returns nil if the observation must be discarded.
+func (s *sender) vec(vecs map[string]*vec, name, stat string, keys, values []string,
+	create func(s *sender, name string, d Descriptor, keys []string) prometheus.Collector) (prometheus.Collector, []string) {
+	m := s.lookup(vecs, name, stat, keys, create)
+	if m == nil {
+		return nil, nil
+	}
+	lv, ok := labelValues(m.keys, keys, values)
+	if ok {
+		return s.admit(m, m.c, lv)
+	}
+	atomic.AddUint64(&s.mismatches, 1)
+	switch s.labelPolicy {
+	case UnionLabels:
+		c, lv := m.union(keys, values)
+		return s.admit(m, c, lv)
+	case DropMismatched:
+		return nil, nil
+	case SplitMismatched:
+		m = s.lookup(vecs, splitName(name, keys), stat, keys, create)
+		if m == nil {
+			return nil, nil
+		}
+		if lv, ok = labelValues(m.keys, keys, values); !ok {
+			return nil, nil
+		}
+	}
+	return s.admit(m, m.c, lv)
+}
+
+// lookup returns the vector of a metric, registering the collector returned
+// by create with the descriptor of stat on first use. It returns nil if the
+// collector could not be registered.
+func (s *sender) lookup(vecs map[string]*vec, name, stat string, keys []string,
+	create func(s *sender, name string, d Descriptor, keys []string) prometheus.Collector) *vec {
 	s.RLock()
-	m, ok := s.histograms[stat]
+	m, ok := vecs[name]
 	s.RUnlock()
-	keys, values := splitTags(tags)
 	if !ok {
 		s.Lock()
-		if m, ok = s.histograms[stat]; !ok {
-			m = prometheus.NewHistogramVec(
-				prometheus.HistogramOpts{Name: stat, Help: stat},
-				keys)
-			prometheus.MustRegister(m)
-			s.histograms[stat] = m
+		if m, ok = vecs[name]; !ok {
+			d := s.descriptor(name, stat)
+			// Copy the keys as the caller may reuse them
+			m = &vec{
+				c:    create(s, name, d, keys),
+				keys: append([]string(nil), keys...),
+				name: name,
+				ttl:  s.ttl,
+				max:  s.maxSeries,
+				create: func(keys []string) prometheus.Collector {
+					return create(s, name, d, keys)
+				},
+			}
+			if c := s.register(m); c != nil {
+				m = c.(*vec)
+				vecs[name] = m
+			} else {
+				m = nil
+			}
 		}
 		s.Unlock()
 	}
-	m.WithLabelValues(values...).Observe(value)
+	return m
+}
+
+// register registers c with the sender's registerer. It returns the collector
+// already registered for the same metric if it has the same type, or nil if c
+// could not be registered, reporting the error.
+func (s *sender) register(c prometheus.Collector) prometheus.Collector {
+	err := s.registerer.Register(c)
+	if err == nil {
+		return c
+	}
+	if are, ok := err.(prometheus.AlreadyRegisteredError); ok && sameType(are.ExistingCollector, c) {
+		return are.ExistingCollector
+	}
+	atomic.AddUint64(&s.registerErrors, 1)
+	s.onError(err)
+	return nil
+}
+
+// sameType returns true if the collectors have the same type, comparing the
+// collectors of vectors.
+func sameType(c1, c2 prometheus.Collector) bool {
+	if v1, ok := c1.(*vec); ok {
+		if v2, ok := c2.(*vec); ok {
+			return reflect.TypeOf(v1.c) == reflect.TypeOf(v2.c)
+		}
+	}
+	return reflect.TypeOf(c1) == reflect.TypeOf(c2)
+}
+
+// fail reports an observation rejected by prometheus, counted as invalid.
+func (s *sender) fail(err error) {
+	atomic.AddUint64(&s.invalid, 1)
+	s.onError(err)
 }
 
-// Timing implements xstats.Sender interface - simulates Timing with Gauge.
+// Set implements xstats.SetSender interface - simulates Set with a gauge of
+// the number of unique values seen during the last 10 seconds interval.
 //
 // Mark the tags as "key:value".
-func (s *sender) Timing(stat string, duration time.Duration, tags ...string) {
-	s.Gauge(stat, float64(duration/time.Millisecond), tags...)
+func (s *sender) Set(stat string, value string, tags ...string) {
+	stat, tags, ok := s.sanitize(stat, tags)
+	if !ok {
+		return
+	}
+	keys, values := splitTags(tags)
+	if c, values := s.vec(s.sets, stat, stat, keys, values, newSet); c != nil {
+		c.(*setCollector).add(values, value)
+	}
 }
 
 func splitTags(tags []string) ([]string, []string) {
@@ -123,3 +680,12 @@ func splitTags(tags []string) ([]string, []string) {
 	}
 	return keys, values
 }
+
+func splitTagPairs(tags []xstats.Tag) ([]string, []string) {
+	keys, values := make([]string, len(tags)), make([]string, len(tags))
+	for i, t := range tags {
+		keys[i] = t.Key
+		values[i] = t.Value
+	}
+	return keys, values
+}
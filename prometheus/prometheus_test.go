@@ -8,9 +8,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/xstats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -53,6 +56,29 @@ func TestGauge(t *testing.T) {
 	assert.Equal(t, "metric1_g{tag=\"1\"} 1\nmetric2_g{gat=\"2\",tag=\"1\"} -2\n", buf.String())
 }
 
+func TestGaugeDelta(t *testing.T) {
+	c := NewHandler()
+	c.Gauge("metric1_d", 1, "tag:1")
+	c.GaugeDelta("metric1_d", 2, "tag:1")
+	c.GaugeDelta("metric2_d", -2)
+	buf := &bytes.Buffer{}
+	get(buf, c, 'd')
+
+	assert.Equal(t, "metric1_d{tag=\"1\"} 3\nmetric2_d -2\n", buf.String())
+}
+
+func TestNegativeCount(t *testing.T) {
+	c := NewHandler()
+	c.Count("metric1_n", 2)
+	c.Count("metric1_n", -1)
+	c.CountT("metric1_n", -1)
+	buf := &bytes.Buffer{}
+	get(buf, c, 'n')
+
+	assert.Equal(t, "metric1_n 2\n", buf.String())
+	assert.Equal(t, Stats{NegativeCounts: 2}, c.Stats())
+}
+
 func TestHistogram(t *testing.T) {
 	c := NewHandler()
 	c.Histogram("metric1_h", 1, "tag:1")
@@ -64,11 +90,329 @@ func TestHistogram(t *testing.T) {
 }
 
 func TestTiming(t *testing.T) {
-	c := NewHandler()
-	c.Timing("metric1_t", time.Second, "tag:1")
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg, Buckets("metric", 1), Buckets("metric1.", 0.5, 2))
+	c.Timing("metric1.t", time.Second, "tag:1")
 	c.Timing("metric2_t", 2*time.Second, "tag:1", "gat:2")
+	c.TimingT("metric2_t_seconds", time.Second, xstats.Tag{Key: "tag", Value: "1"}, xstats.Tag{Key: "gat", Value: "2"})
 	buf := &bytes.Buffer{}
 	get(buf, c, 't')
 
-	assert.Equal(t, "metric1_t{tag=\"1\"} 1000\nmetric2_t{gat=\"2\",tag=\"1\"} 2000\n", buf.String())
+	assert.Equal(t, "metric1_t_seconds_bucket{tag=\"1\",le=\"0.5\"} 0\n"+
+		"metric1_t_seconds_bucket{tag=\"1\",le=\"2\"} 1\n"+
+		"metric1_t_seconds_bucket{tag=\"1\",le=\"+Inf\"} 1\n"+
+		"metric1_t_seconds_sum{tag=\"1\"} 1\n"+
+		"metric1_t_seconds_count{tag=\"1\"} 1\n"+
+		"metric2_t_seconds_bucket{gat=\"2\",tag=\"1\",le=\"1\"} 1\n"+
+		"metric2_t_seconds_bucket{gat=\"2\",tag=\"1\",le=\"+Inf\"} 2\n"+
+		"metric2_t_seconds_sum{gat=\"2\",tag=\"1\"} 3\n"+
+		"metric2_t_seconds_count{gat=\"2\",tag=\"1\"} 2\n", buf.String())
+}
+
+func TestTimingSummary(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg, TimingSummary(map[float64]float64{0.5: 0.05}))
+	c.Timing("metric1_s", time.Second)
+	buf := &bytes.Buffer{}
+	get(buf, c, 's')
+
+	assert.Equal(t, "metric1_s_seconds{quantile=\"0.5\"} 1\n"+
+		"metric1_s_seconds_sum 1\n"+
+		"metric1_s_seconds_count 1\n", buf.String())
+}
+
+func TestSet(t *testing.T) {
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	c := NewHandler()
+	c.Set("metric1_s", "a", "tag:1")
+	c.Set("metric1_s", "b", "tag:1")
+	c.Set("metric1_s", "a", "tag:1")
+	c.Set("metric1_s", "a", "tag:2")
+	buf := &bytes.Buffer{}
+	get(buf, c, 's')
+
+	assert.Equal(t, "metric1_s{tag=\"1\"} 0\nmetric1_s{tag=\"2\"} 0\n", buf.String())
+
+	start = start.Add(setInterval)
+	buf.Reset()
+	get(buf, c, 's')
+
+	assert.Equal(t, "metric1_s{tag=\"1\"} 2\nmetric1_s{tag=\"2\"} 1\n", buf.String())
+}
+
+func TestSanitizer(t *testing.T) {
+	s := Sanitizer{}
+	assert.Equal(t, "foo_bar:baz", s.Name("foo_bar:baz"))
+	assert.Equal(t, "foo_bar_baz", s.Name("foo.bar-baz"))
+	assert.Equal(t, "_1foo", s.Name("1foo"))
+	assert.Equal(t, "env:prod", s.Tag("env:prod"))
+	assert.Equal(t, "a_b:c.d", s.Tag("a.b:c.d"))
+}
+
+func TestSanitize(t *testing.T) {
+	c := NewHandler()
+	c.Count("metric1.x", 1, "tag.a:1")
+	buf := &bytes.Buffer{}
+	get(buf, c, 'x')
+	assert.Equal(t, "metric1_x{tag_a=\"1\"} 1\n", buf.String())
+
+	c = NewHandler(OnInvalidName(xstats.RejectInvalid))
+	c.Count("metric2.x", 1)
+	assert.Equal(t, Stats{InvalidNames: 1}, c.Stats())
+}
+
+func TestReservedLabels(t *testing.T) {
+	var errs []error
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg, OnError(func(err error) { errs = append(errs, err) }))
+	c.Histogram("metric_r", 1, "le:1")
+	c.Timing("metric_r", time.Second, "le:1")
+	c.Count("metric_r", 1, "le:1")
+	assert.Equal(t, Stats{InvalidNames: 2}, c.Stats())
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, &xstats.InvalidNameError{Stat: "metric_r", Tags: []string{"le"}}, errs[0])
+	}
+
+	c = NewHandlerFor(reg, reg, TimingSummary(map[float64]float64{0.5: 0.05}))
+	c.Timing("metric_q", time.Second, "quantile:1")
+	c.Histogram("metric_q", 1, "quantile:1")
+	assert.Equal(t, Stats{InvalidNames: 1}, c.Stats())
+}
+
+func TestTagPairs(t *testing.T) {
+	c := NewHandler()
+	c.CountT("metric1_p", 1, xstats.Tag{Key: "tag", Value: "1"}, xstats.Tag{Key: "gat"})
+	buf := &bytes.Buffer{}
+	get(buf, c, 'p')
+	assert.Equal(t, "metric1_p{gat=\"\",tag=\"1\"} 1\n", buf.String())
+}
+
+func TestNewHandlerFor(t *testing.T) {
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	reg := prometheus.NewRegistry()
+	var errs []error
+	onError := OnError(func(err error) {
+		errs = append(errs, err)
+	})
+	c1 := NewHandlerFor(reg, reg, Namespace("metric"), Subsystem("f"), onError)
+	c2 := NewHandlerFor(reg, reg, Namespace("metric"), Subsystem("f"), onError)
+
+	// Senders sharing a registry share the metrics
+	c1.Count("count", 1)
+	c2.Count("count", 2)
+	c1.Set("set", "a")
+	c2.Set("set", "b")
+	// Registering the same name with another type fails
+	c2.Gauge("count", 1)
+	// Sets report the unique values of the last completed interval
+	start = start.Add(setInterval)
+	buf := &bytes.Buffer{}
+	get(buf, c1, 'f')
+
+	assert.Equal(t, "metric_f_count 3\nmetric_f_set 2\n", buf.String())
+	assert.Len(t, errs, 1)
+	assert.Equal(t, Stats{}, c1.Stats())
+	assert.Equal(t, Stats{RegisterErrors: 1}, c2.Stats())
+}
+
+func TestLabelValues(t *testing.T) {
+	lv, ok := labelValues([]string{"a", "b"}, []string{"a", "b"}, []string{"1", "2"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"1", "2"}, lv)
+	lv, ok = labelValues([]string{"a", "b"}, []string{"b", "a"}, []string{"2", "1"})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"1", "2"}, lv)
+	lv, ok = labelValues([]string{"a", "b"}, []string{"b", "c"}, []string{"2", "3"})
+	assert.False(t, ok)
+	assert.Equal(t, []string{"", "2"}, lv)
+	_, ok = labelValues([]string{"a"}, []string{"a", "a"}, []string{"1", "2"})
+	assert.False(t, ok)
+
+	assert.Equal(t, "stat_by_a_b", splitName("stat", []string{"b", "a"}))
+	assert.Equal(t, "stat_unlabeled", splitName("stat", nil))
+	assert.Equal(t, "stat_by_a_seconds", splitName("stat_seconds", []string{"a"}))
+	assert.Equal(t, "stat_unlabeled_seconds", splitName("stat_seconds", nil))
+}
+
+func TestUnionLabels(t *testing.T) {
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg, SeriesTTL(time.Hour))
+	c.Count("metric_u", 1, "a:1")
+	c.Count("metric_u", 1, "b:2")
+	c.Count("metric_u", 1, "a:1", "b:2")
+	c.Count("metric_u", 1, "b:2", "c:3")
+	c.Count("metric_u", 1)
+	c.Count("metric_u", 1, "b:2", "a:")
+	c.Histogram("metric_u2", 1, "a:1")
+	c.Histogram("metric_u2", 1, "b:1")
+	buf := &bytes.Buffer{}
+	get(buf, c, 'u')
+
+	// Each series has the labels of the first label set holding its tags
+	assert.Equal(t, "metric_u{a=\"\"} 1\n"+
+		"metric_u{a=\"1\"} 1\n"+
+		"metric_u{a=\"\",b=\"2\"} 2\n"+
+		"metric_u{a=\"1\",b=\"2\"} 1\n"+
+		"metric_u{a=\"\",b=\"2\",c=\"3\"} 1\n"+
+		"metric_u2_bucket{a=\"1\",le=\"+Inf\"} 1\n"+
+		"metric_u2_bucket{a=\"\",b=\"1\",le=\"+Inf\"} 1\n", strings.Join(grep(buf.String(), "metric_u{", "+Inf"), ""))
+	assert.Equal(t, Stats{LabelMismatches: 6}, c.Stats())
+
+	// The series of all the label sets expire
+	start = start.Add(2 * time.Hour)
+	buf.Reset()
+	get(buf, c, 'u')
+	assert.Empty(t, grep(buf.String(), "metric_u{", "+Inf"))
+}
+
+// grep returns the lines of s containing one of the patterns.
+func grep(s string, patterns ...string) []string {
+	var lines []string
+	for _, l := range strings.SplitAfter(s, "\n") {
+		for _, p := range patterns {
+			if strings.Contains(l, p) {
+				lines = append(lines, l)
+				break
+			}
+		}
+	}
+	return lines
+}
+
+func TestLabelMismatch(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg, OnLabelMismatch(ProjectLabels))
+	c.Count("metric_m", 1, "a:1", "b:2")
+	c.Count("metric_m", 1, "b:2", "a:1")
+	c.Count("metric_m", 1, "a:1")
+	c.Count("metric_m", 1, "a:1", "b:2", "c:3")
+	c.Gauge("metric_m2", 1)
+	c.Gauge("metric_m2", 2, "a:1")
+	buf := &bytes.Buffer{}
+	get(buf, c, 'm')
+
+	// The tags are projected onto the labels of the first observation, c is dropped
+	assert.Equal(t, "metric_m{a=\"1\",b=\"\"} 1\n"+
+		"metric_m{a=\"1\",b=\"2\"} 3\n"+
+		"metric_m2 2\n", buf.String())
+	assert.Equal(t, Stats{LabelMismatches: 3}, c.Stats())
+
+	reg = prometheus.NewRegistry()
+	c = NewHandlerFor(reg, reg, OnLabelMismatch(DropMismatched))
+	c.Count("metric_m", 1, "a:1")
+	c.Count("metric_m", 1, "b:1")
+	buf.Reset()
+	get(buf, c, 'm')
+	assert.Equal(t, "metric_m{a=\"1\"} 1\n", buf.String())
+	assert.Equal(t, Stats{LabelMismatches: 1}, c.Stats())
+
+	reg = prometheus.NewRegistry()
+	c = NewHandlerFor(reg, reg, OnLabelMismatch(SplitMismatched))
+	c.Count("metric_m", 1, "a:1")
+	c.Count("metric_m", 1, "c:1", "b:2")
+	c.Count("metric_m", 1)
+	buf.Reset()
+	get(buf, c, 'm')
+	assert.Equal(t, "metric_m{a=\"1\"} 1\n"+
+		"metric_m_by_b_c{b=\"2\",c=\"1\"} 1\n"+
+		"metric_m_unlabeled 1\n", buf.String())
+	assert.Equal(t, Stats{LabelMismatches: 2}, c.Stats())
+
+	c.Timing("metric_t", time.Second, "a:1")
+	c.Timing("metric_t", time.Second, "b:1")
+	c.Timing("metric_t", time.Second)
+	buf.Reset()
+	get(buf, c, 't')
+	assert.Equal(t, []string{"metric_t_by_b_seconds_count{b=\"1\"} 1\n",
+		"metric_t_seconds_count{a=\"1\"} 1\n",
+		"metric_t_unlabeled_seconds_count 1\n"}, grep(buf.String(), "_count"))
+}
+
+func TestDescribe(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg,
+		Describe("metric*_d", Descriptor{Unit: "bytes", ConstLabels: prometheus.Labels{"env": "prod"}}),
+		Describe("metric2_d", Descriptor{Help: "Sizes.", Buckets: []float64{1}}))
+	c.Gauge("metric1_d", 3)
+	c.Histogram("metric2_d", 0.5)
+	buf := &bytes.Buffer{}
+	get(buf, c, 'd')
+
+	assert.Equal(t, "metric1_d_bytes{env=\"prod\"} 3\n"+
+		"metric2_d_bucket{le=\"1\"} 1\n"+
+		"metric2_d_bucket{le=\"+Inf\"} 1\n"+
+		"metric2_d_sum 0.5\n"+
+		"metric2_d_count 1\n", buf.String())
+}
+
+func TestDescriptor(t *testing.T) {
+	s := newSender(prometheus.NewRegistry(), []Option{Buckets("metric", 1),
+		Describe("metric_*", Descriptor{Help: "Glob."}), Describe("metric_a", Descriptor{Help: "Exact."})})
+	assert.Equal(t, Descriptor{Help: "Exact.", Buckets: []float64{1}}, s.descriptor("metric_a", "metric_a"))
+	assert.Equal(t, Descriptor{Help: "Glob.", Buckets: []float64{1}}, s.descriptor("metric_t_seconds", "metric_t"))
+	assert.Equal(t, Descriptor{Help: "metric", Buckets: []float64{1}}, s.descriptor("metric", "metric"))
+
+	assert.Equal(t, "metric_bytes", withUnit("metric", "bytes"))
+	assert.Equal(t, "metric_bytes", withUnit("metric_bytes", "bytes"))
+	assert.Equal(t, "metric", withUnit("metric", ""))
+}
+
+func TestSeriesTTL(t *testing.T) {
+	start := time.Now()
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg, SeriesTTL(time.Minute))
+	c.Count("metric_e", 1, "a:1")
+	c.Count("metric_e", 1, "a:2")
+	c.Set("metric_e2", "x", "a:1")
+	start = start.Add(time.Minute)
+	c.Count("metric_e", 1, "a:2")
+	buf := &bytes.Buffer{}
+	get(buf, c, 'e')
+
+	assert.Equal(t, "metric_e{a=\"1\"} 1\n"+
+		"metric_e{a=\"2\"} 2\n"+
+		"metric_e2{a=\"1\"} 0\n", buf.String())
+
+	start = start.Add(time.Second)
+	buf.Reset()
+	get(buf, c, 'e')
+	assert.Equal(t, "metric_e{a=\"2\"} 2\n", buf.String())
+
+	c.Count("metric_e", 1, "a:1")
+	buf.Reset()
+	get(buf, c, 'e')
+	assert.Equal(t, "metric_e{a=\"1\"} 1\n"+
+		"metric_e{a=\"2\"} 2\n", buf.String())
+}
+
+func TestMaxSeries(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := NewHandlerFor(reg, reg, Namespace("metric"), MaxSeries(2))
+	c.Count("o", 1, "a:1")
+	c.Count("o", 1, "a:2")
+	c.Count("o", 1, "a:3")
+	c.Count("o", 1, "a:1")
+	c.Gauge("o2", 1, "a:3")
+	buf := &bytes.Buffer{}
+	get(buf, c, 'o')
+	get(buf, c, 'x')
+
+	assert.Equal(t, "metric_o{a=\"1\"} 2\n"+
+		"metric_o{a=\"2\"} 1\n"+
+		"metric_o2{a=\"3\"} 1\n"+
+		"metric_xstats_series_overflow_total{metric=\"o\"} 1\n", buf.String())
+	assert.Equal(t, Stats{SeriesOverflows: 1}, c.Stats())
 }
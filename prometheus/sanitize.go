@@ -0,0 +1,46 @@
+package prometheus
+
+import (
+	"strings"
+)
+
+// Sanitizer is the default xstats.Sanitizer of prometheus senders. It
+// replaces the characters not allowed in metric names ([a-zA-Z_:][a-zA-Z0-9_:]*)
+// and label names ([a-zA-Z_][a-zA-Z0-9_]*) with '_'. Label names are the part
+// of the tags before the first ':', label values are left untouched.
+type Sanitizer struct{}
+
+// Name implements xstats.Sanitizer interface
+func (Sanitizer) Name(stat string) string {
+	return sanitize(stat, true)
+}
+
+// Tag implements xstats.Sanitizer interface
+func (Sanitizer) Tag(tag string) string {
+	i := strings.IndexByte(tag, ':')
+	if i < 0 {
+		return sanitize(tag, false)
+	}
+	if k := sanitize(tag[:i], false); k != tag[:i] {
+		return k + tag[i:]
+	}
+	return tag
+}
+
+// sanitize replaces the characters not allowed in a metric name, or in a label
+// name if colon is false. Names starting with a digit are prefixed with '_'.
+func sanitize(name string, colon bool) string {
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r == ':' && colon:
+			return r
+		}
+		return '_'
+	}, name)
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
@@ -0,0 +1,124 @@
+package prometheus
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// series is a label set of a metric with the time of its last observation.
+type series struct {
+	c      deleter
+	values []string
+	last   time.Time
+}
+
+// deleter is implemented by the collectors of vectors.
+type deleter interface {
+	DeleteLabelValues(lvs ...string) bool
+}
+
+// SeriesTTL makes the series of a metric not observed for ttl removed from
+// the metric when it is next collected. The series is created again, from
+// zero for counters, by its next observation. Series never expire by
+// default.
+func SeriesTTL(ttl time.Duration) Option {
+	return func(s *sender) {
+		s.ttl = ttl
+	}
+}
+
+// MaxSeries limits the number of series of each metric. Observations adding
+// a series to a metric reaching the limit are discarded and counted in the
+// xstats_series_overflow_total counter, labeled with the stat name. Unlimited
+// by default.
+func MaxSeries(n int) Option {
+	return func(s *sender) {
+		s.maxSeries = n
+	}
+}
+
+func newOverflow(s *sender) prometheus.Collector {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{Namespace: s.namespace, Subsystem: s.subsystem,
+			Name: "xstats_series_overflow_total",
+			Help: "Observations discarded because their metric reached the series limit."},
+		[]string{"metric"})
+}
+
+// admit returns the collector of m and label values of an observation, or nil
+// if the observation adds a series to a vector reaching the series limit.
+func (s *sender) admit(m *vec, c prometheus.Collector, values []string) (prometheus.Collector, []string) {
+	if m.touch(c, values) {
+		return c, values
+	}
+	atomic.AddUint64(&s.overflows, 1)
+	if s.overflow != nil {
+		s.overflow.WithLabelValues(m.name).Inc()
+	}
+	return nil, nil
+}
+
+// touch records an observation of the series of c with the label values. It
+// returns false if the series is new and the vector reached its series limit.
+func (v *vec) touch(c prometheus.Collector, values []string) bool {
+	if v.ttl <= 0 && v.max <= 0 {
+		return true
+	}
+	// The label sets of a vector have different lengths
+	k := strconv.Itoa(len(values)) + "\xff" + strings.Join(values, "\xff")
+	t := now()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if e, ok := v.series[k]; ok {
+		e.last = t
+		return true
+	}
+	if v.max > 0 && len(v.series) >= v.max {
+		return false
+	}
+	if v.series == nil {
+		v.series = make(map[string]*series)
+	}
+	// Copy the values as the caller may reuse them
+	v.series[k] = &series{c: c.(deleter), values: append([]string(nil), values...), last: t}
+	return true
+}
+
+// expire removes the series not observed for the vector's TTL.
+func (v *vec) expire() {
+	if v.ttl <= 0 {
+		return
+	}
+	deadline := now().Add(-v.ttl)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, e := range v.series {
+		if e.last.Before(deadline) {
+			delete(v.series, k)
+			e.c.DeleteLabelValues(e.values...)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector interface - only describes the
+// first label set of the vector, see UnionLabels.
+func (v *vec) Describe(ch chan<- *prometheus.Desc) {
+	v.c.Describe(ch)
+}
+
+// Collect implements prometheus.Collector interface - removes the expired
+// series before collecting the metric.
+func (v *vec) Collect(ch chan<- prometheus.Metric) {
+	v.expire()
+	v.c.Collect(ch)
+	v.mu.Lock()
+	widened := v.widened
+	v.mu.Unlock()
+	for _, w := range widened {
+		w.c.Collect(ch)
+	}
+}
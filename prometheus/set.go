@@ -0,0 +1,79 @@
+package prometheus
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/xstats/internal/uniq"
+)
+
+// setInterval is the interval over which unique values of sets are counted.
+const setInterval = 10 * time.Second
+
+var now = time.Now
+
+// setCollector is a prometheus.Collector emulating statsd sets with a gauge
+// reporting the number of unique values seen during the last set interval.
+type setCollector struct {
+	desc *prometheus.Desc
+
+	mu     sync.Mutex
+	sets   map[string]*uniq.Counter
+	values map[string][]string
+}
+
+// newSetCollector returns a collector of sets published with the fully
+// qualified name.
+func newSetCollector(name, help string, keys []string, constLabels prometheus.Labels) *setCollector {
+	return &setCollector{
+		desc:   prometheus.NewDesc(name, help, keys, constLabels),
+		sets:   make(map[string]*uniq.Counter),
+		values: make(map[string][]string),
+	}
+}
+
+// add adds a value to the set identified by the label values.
+func (c *setCollector) add(labelValues []string, value string) {
+	k := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	s, ok := c.sets[k]
+	if !ok {
+		s = uniq.NewClock(setInterval, func() time.Time { return now() })
+		c.sets[k] = s
+		c.values[k] = labelValues
+	}
+	c.mu.Unlock()
+	s.Add(value)
+}
+
+// Describe implements prometheus.Collector interface
+func (c *setCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector interface
+func (c *setCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, s := range c.sets {
+		m, err := prometheus.NewConstMetric(c.desc, prometheus.GaugeValue, float64(s.Count()), c.values[k]...)
+		if err != nil {
+			// Invalid label values can't be collected
+			continue
+		}
+		ch <- m
+	}
+}
+
+// DeleteLabelValues removes the set identified by the label values.
+func (c *setCollector) DeleteLabelValues(labelValues ...string) bool {
+	k := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.sets[k]
+	delete(c.sets, k)
+	delete(c.values, k)
+	return ok
+}
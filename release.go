@@ -0,0 +1,96 @@
+package xstats
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// UseAfterCloseError describes an observation sent to an XStater after it was
+// closed, like from a goroutine still using the instance of a request after
+// its handler returned.
+type UseAfterCloseError struct {
+	// Stat is the name of the observation, without the prefix of the XStater.
+	Stat string
+	// Stack is the stack of the goroutine sending the observation. It is only
+	// captured in debug builds.
+	Stack []byte
+	// CloseStack is the stack of the goroutine which closed the XStater. It
+	// is only captured in debug builds.
+	CloseStack []byte
+}
+
+func (e *UseAfterCloseError) Error() string {
+	return fmt.Sprintf("xstats: %s observed after close", e.Stat)
+}
+
+// OnUseAfterClose is called with observations sent to a closed XStater, which
+// are discarded. It must be set before any XStater is used.
+//
+// Late observations are detected even once the closed XStater was returned to
+// the pool and reused by another request. Building with the xstatsdebug tag
+// also reports the stacks of the observation and of the close, keeping closed
+// instances out of the pool.
+var OnUseAfterClose func(err *UseAfterCloseError)
+
+// released reports the observation of stat sent to xs once closed to
+// OnUseAfterClose.
+func (xs *xstats) released(stat string) {
+	h := OnUseAfterClose
+	if h == nil {
+		return
+	}
+	err := &UseAfterCloseError{Stat: stat}
+	if debugPooling {
+		err.Stack = debug.Stack()
+		xs.mu.RLock()
+		err.CloseStack = xs.closeStack
+		xs.mu.RUnlock()
+	}
+	h(err)
+}
+
+// Detach returns a copy of xs which is never returned to the pool, even when
+// closed. Unlike xs, it can be kept by a goroutine outliving the request
+// handler which created xs. It returns a nop stats if xs is not a Copier.
+func Detach(xs XStater) XStater {
+	if c, ok := xs.(*xstats); ok {
+		return c.copy(false)
+	}
+	return Copy(xs)
+}
+
+// HandlerOption configures the handlers created by NewHandler and
+// NewHandlerPrefix.
+type HandlerOption func(*Handler)
+
+// newHandler creates a handler building the instance of each request with f,
+// or with s if f is nil.
+func newHandler(s Sender, f *Factory, tags []string, prefix string, opts []HandlerOption) *Handler {
+	h := &Handler{s: s, f: f, tags: tags, prefix: prefix}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// pooling returns true if the instances of requests are taken from the pool.
+// Handlers created without a factory read DisablePooling on each request.
+func (h *Handler) pooling() bool {
+	if h.detach {
+		return false
+	}
+	if h.f == nil {
+		return !DisablePooling
+	}
+	return h.f.pooling
+}
+
+// DetachRequests makes the handler leave the instance of each request to the
+// garbage collector instead of closing it, so goroutines started by the
+// request can keep using it after the handler returned. It is like a
+// Factory created with WithPooling(false).
+func DetachRequests() HandlerOption {
+	return func(h *Handler) {
+		h.detach = true
+	}
+}
@@ -0,0 +1,123 @@
+package xstats
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUseAfterClose(t *testing.T) {
+	var errs []*UseAfterCloseError
+	OnUseAfterClose = func(err *UseAfterCloseError) {
+		errs = append(errs, err)
+	}
+	debugPooling = false
+	defer func() {
+		OnUseAfterClose = nil
+		debugPooling = debugBuild
+	}()
+
+	s := &fakeSender{}
+	xs := New(s)
+	xs.Count("before", 1)
+	xs.(*xstats).Close()
+	xs.Count("after", 1)
+	xs.CountSampled("sampled", 1, 1)
+	xs.Event(Event{Title: "event"})
+
+	assert.Equal(t, cmd{"Count", "before", 1, nil}, s.last)
+	if assert.Len(t, errs, 3) {
+		assert.EqualError(t, errs[0], "xstats: after observed after close")
+		assert.Equal(t, "sampled", errs[1].Stat)
+		assert.Equal(t, "event", errs[2].Stat)
+		assert.Nil(t, errs[0].Stack)
+	}
+
+	// The state of the closed instance is reused by another instance
+	defer func(pool *sync.Pool) {
+		xstatsPool = pool
+	}(xstatsPool)
+	st := xs.(*xstats).state
+	xstatsPool = &sync.Pool{
+		New: func() interface{} {
+			return st
+		},
+	}
+	s2 := &fakeSender{}
+	xs2 := New(s2).(*xstats)
+	assert.Equal(t, st, xs2.state)
+	xs.Count("late", 1)
+	xs.AddTags("late")
+	Close(xs)
+	xs2.Count("reused", 1)
+	assert.Equal(t, cmd{"Count", "reused", 1, nil}, s2.last)
+	assert.Equal(t, []string(nil), xs2.GetTags())
+	if assert.Len(t, errs, 4) {
+		assert.Equal(t, "late", errs[3].Stat)
+	}
+}
+
+func TestUseAfterCloseConcurrent(t *testing.T) {
+	xs := New(nop)
+	xs.AddTags("foo")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			xs.Count("metric", 1)
+			xs.AddTags("bar")
+		}
+	}()
+	Close(xs)
+	<-done
+}
+
+func TestUseAfterCloseDebug(t *testing.T) {
+	var err *UseAfterCloseError
+	OnUseAfterClose = func(e *UseAfterCloseError) {
+		err = e
+	}
+	debugPooling = true
+	defer func() {
+		OnUseAfterClose = nil
+		debugPooling = debugBuild
+	}()
+
+	s := &fakeSender{}
+	xs := NewPrefix(s, "prefix.").(*xstats)
+	xs.AddTags("foo")
+	xs.Close()
+	xs.Gauge("gauge", 1)
+
+	// The instance is left as is and never reused
+	assert.Equal(t, s, xs.s)
+	assert.Equal(t, []string{"foo"}, xs.tags)
+	assert.Equal(t, cmd{}, s.last)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "gauge", err.Stat)
+		assert.Contains(t, string(err.Stack), "TestUseAfterCloseDebug")
+		assert.Contains(t, string(err.CloseStack), "TestUseAfterCloseDebug")
+	}
+}
+
+func TestDetach(t *testing.T) {
+	called := false
+	OnUseAfterClose = func(err *UseAfterCloseError) {
+		called = true
+	}
+	defer func() { OnUseAfterClose = nil }()
+
+	s := &fakeSender{}
+	xs := NewPrefix(s, "prefix.").(*xstats)
+	xs.AddTags("foo")
+	d := Detach(xs)
+	xs.Close()
+	d.Count("metric", 1)
+	Close(d)
+	d.Count("metric", 2)
+
+	assert.False(t, called)
+	assert.Equal(t, cmd{"Count", "prefix.metric", 2, []string{"foo"}}, s.last)
+	assert.Equal(t, nop, Detach(nop))
+}
@@ -0,0 +1,77 @@
+package xstats
+
+import "strconv"
+
+// Sanitizer rewrites stat names and tags into the form accepted by a backend.
+// Valid names and tags must be returned unchanged.
+type Sanitizer interface {
+	// Name returns stat with its invalid characters replaced or escaped.
+	Name(stat string) string
+
+	// Tag returns tag with its invalid characters replaced or escaped.
+	Tag(tag string) string
+}
+
+// ValueSanitizer is an optional interface for Sanitizer rewriting the values
+// of sets, which are written as is by line protocols.
+type ValueSanitizer interface {
+	// Value returns the value of a set with its invalid characters replaced.
+	Value(value string) string
+}
+
+// SanitizePolicy defines what a sender does with an observation having an
+// invalid name or tag.
+type SanitizePolicy int
+
+const (
+	// Rewrite sends the observation with the name and tags rewritten by the
+	// sanitizer. This is the default.
+	Rewrite SanitizePolicy = iota
+	// CountInvalid sends the observation as is and counts it.
+	CountInvalid
+	// RejectInvalid discards the observation and counts it.
+	RejectInvalid
+)
+
+// InvalidNameError is reported by senders rejecting an observation with an
+// invalid name or tag.
+type InvalidNameError struct {
+	Stat string
+	Tags []string
+}
+
+// Error implements the error interface
+func (e *InvalidNameError) Error() string {
+	return "xstats: invalid name or tags for " + e.Stat
+}
+
+// InvalidSetValueError is reported by senders rejecting a set value with
+// characters reserved by their protocol.
+type InvalidSetValueError struct {
+	Stat  string
+	Value string
+}
+
+// Error implements the error interface
+func (e *InvalidSetValueError) Error() string {
+	return "xstats: invalid set value " + strconv.Quote(e.Value) + " for " + e.Stat
+}
+
+// Sanitize returns stat and tags rewritten by s and whether they were all
+// valid. The tags are only copied if one of them is rewritten.
+func Sanitize(s Sanitizer, stat string, tags []string) (string, []string, bool) {
+	name := s.Name(stat)
+	var sanitized []string
+	for i, tag := range tags {
+		if t := s.Tag(tag); t != tag {
+			if sanitized == nil {
+				sanitized = append([]string(nil), tags...)
+			}
+			sanitized[i] = t
+		}
+	}
+	if sanitized == nil {
+		return name, tags, name == stat
+	}
+	return name, sanitized, false
+}
@@ -0,0 +1,43 @@
+package xstats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dashSanitizer replaces dashes with underscores.
+type dashSanitizer struct{}
+
+func (dashSanitizer) Name(stat string) string {
+	return strings.Replace(stat, "-", "_", -1)
+}
+
+func (dashSanitizer) Tag(tag string) string {
+	return strings.Replace(tag, "-", "_", -1)
+}
+
+func TestSanitize(t *testing.T) {
+	tags := []string{"a:b", "c:d"}
+	stat, sanitized, valid := Sanitize(dashSanitizer{}, "foo.bar", tags)
+	assert.True(t, valid)
+	assert.Equal(t, "foo.bar", stat)
+	assert.Equal(t, &tags[0], &sanitized[0])
+
+	stat, _, valid = Sanitize(dashSanitizer{}, "foo-bar", tags)
+	assert.False(t, valid)
+	assert.Equal(t, "foo_bar", stat)
+
+	tags = []string{"a:b", "c:d-e"}
+	stat, sanitized, valid = Sanitize(dashSanitizer{}, "foo", tags)
+	assert.False(t, valid)
+	assert.Equal(t, "foo", stat)
+	assert.Equal(t, []string{"a:b", "c:d_e"}, sanitized)
+	assert.Equal(t, []string{"a:b", "c:d-e"}, tags)
+}
+
+func TestInvalidNameError(t *testing.T) {
+	err := &InvalidNameError{Stat: "foo|bar"}
+	assert.EqualError(t, err, "xstats: invalid name or tags for foo|bar")
+}
@@ -2,6 +2,7 @@ package xstats
 
 import (
 	"io"
+	"strconv"
 	"time"
 )
 
@@ -27,6 +28,71 @@ type Sender interface {
 	Timing(stat string, value time.Duration, tags ...string)
 }
 
+// InvalidValueError is reported by senders discarding an observation with a
+// value their protocol can't represent, like NaN or an infinity.
+type InvalidValueError struct {
+	Stat  string
+	Value float64
+}
+
+// Error implements the error interface
+func (e *InvalidValueError) Error() string {
+	return "xstats: invalid value " + strconv.FormatFloat(e.Value, 'g', -1, 64) + " for " + e.Stat
+}
+
+// SampledSender is an optional interface for Sender supporting sample rates.
+// The observations passed to its methods have already been sampled by the
+// caller with the given rate, the sender only has to report the rate to the
+// backend so it can scale them up.
+//
+// Observations sampled for a Sender not implementing this interface are
+// scaled up before being sent: counts are divided by the rate and histogram
+// values and timings are repeated 1/rate times, at most 100 times so rates
+// below 0.01 don't flood the sender from the caller's goroutine.
+type SampledSender interface {
+	Sender
+
+	// CountSampled is like Count for an observation sampled at the given rate.
+	CountSampled(stat string, count float64, rate float64, tags ...string)
+
+	// HistogramSampled is like Histogram for an observation sampled at the
+	// given rate.
+	HistogramSampled(stat string, value float64, rate float64, tags ...string)
+
+	// TimingSampled is like Timing for an observation sampled at the given rate.
+	TimingSampled(stat string, value time.Duration, rate float64, tags ...string)
+}
+
+// SetSender is an optional interface for Sender supporting sets.
+type SetSender interface {
+	Sender
+
+	// Set counts the number of unique values observed for a stat during
+	// the report interval, like the number of unique users.
+	Set(stat string, value string, tags ...string)
+}
+
+// GaugeDeltaSender is an optional interface for Sender supporting gauge
+// deltas.
+type GaugeDeltaSender interface {
+	Sender
+
+	// GaugeDelta adds delta, which may be negative, to the current value of
+	// a gauge.
+	GaugeDelta(stat string, delta float64, tags ...string)
+}
+
+// DistributionSender is an optional interface for Sender supporting
+// distributions.
+type DistributionSender interface {
+	Sender
+
+	// Distribution tracks the statistical distribution of a set of values
+	// like Histogram, but the values are aggregated by the backend across
+	// all hosts for globally accurate percentiles.
+	Distribution(stat string, value float64, tags ...string)
+}
+
 // CloseSender will call Close() on any xstats.Sender that implements io.Closer
 func CloseSender(s Sender) error {
 	if c, ok := s.(io.Closer); ok {
@@ -67,6 +133,98 @@ func (s MultiSender) Timing(stat string, duration time.Duration, tags ...string)
 	}
 }
 
+// GaugeT implements the xstats.TagSender interface
+func (s MultiSender) GaugeT(stat string, value float64, tags ...Tag) {
+	for _, ss := range s {
+		gaugeT(ss, stat, value, tags)
+	}
+}
+
+// CountT implements the xstats.TagSender interface
+func (s MultiSender) CountT(stat string, count float64, tags ...Tag) {
+	for _, ss := range s {
+		countT(ss, stat, count, tags)
+	}
+}
+
+// HistogramT implements the xstats.TagSender interface
+func (s MultiSender) HistogramT(stat string, value float64, tags ...Tag) {
+	for _, ss := range s {
+		histogramT(ss, stat, value, tags)
+	}
+}
+
+// TimingT implements the xstats.TagSender interface
+func (s MultiSender) TimingT(stat string, duration time.Duration, tags ...Tag) {
+	for _, ss := range s {
+		timingT(ss, stat, duration, tags)
+	}
+}
+
+// CountSampled implements the xstats.SampledSender interface
+func (s MultiSender) CountSampled(stat string, count float64, rate float64, tags ...string) {
+	for _, ss := range s {
+		countSampled(ss, stat, count, rate, tags)
+	}
+}
+
+// HistogramSampled implements the xstats.SampledSender interface
+func (s MultiSender) HistogramSampled(stat string, value float64, rate float64, tags ...string) {
+	for _, ss := range s {
+		histogramSampled(ss, stat, value, rate, tags)
+	}
+}
+
+// TimingSampled implements the xstats.SampledSender interface
+func (s MultiSender) TimingSampled(stat string, duration time.Duration, rate float64, tags ...string) {
+	for _, ss := range s {
+		timingSampled(ss, stat, duration, rate, tags)
+	}
+}
+
+// Set implements the xstats.SetSender interface
+func (s MultiSender) Set(stat string, value string, tags ...string) {
+	for _, ss := range s {
+		if ss, ok := ss.(SetSender); ok {
+			ss.Set(stat, value, tags...)
+		}
+	}
+}
+
+// GaugeDelta implements the xstats.GaugeDeltaSender interface
+func (s MultiSender) GaugeDelta(stat string, delta float64, tags ...string) {
+	for _, ss := range s {
+		if ss, ok := ss.(GaugeDeltaSender); ok {
+			ss.GaugeDelta(stat, delta, tags...)
+		}
+	}
+}
+
+// Distribution implements the xstats.DistributionSender interface
+func (s MultiSender) Distribution(stat string, value float64, tags ...string) {
+	for _, ss := range s {
+		distribution(ss, stat, value, tags)
+	}
+}
+
+// Event implements the xstats.EventSender interface
+func (s MultiSender) Event(e Event) {
+	for _, ss := range s {
+		if es, ok := ss.(EventSender); ok {
+			es.Event(e)
+		}
+	}
+}
+
+// ServiceCheck implements the xstats.EventSender interface
+func (s MultiSender) ServiceCheck(sc ServiceCheck) {
+	for _, ss := range s {
+		if es, ok := ss.(EventSender); ok {
+			es.ServiceCheck(sc)
+		}
+	}
+}
+
 // Close implements the io.Closer interface
 func (s MultiSender) Close() error {
 	var firstErr error
@@ -79,3 +237,64 @@ func (s MultiSender) Close() error {
 	}
 	return firstErr
 }
+
+// countSampled sends a count sampled at rate to s, scaling it up if s does not
+// support sample rates.
+func countSampled(s Sender, stat string, count, rate float64, tags []string) {
+	if ss, ok := s.(SampledSender); ok {
+		ss.CountSampled(stat, count, rate, tags...)
+		return
+	}
+	s.Count(stat, count/rate, tags...)
+}
+
+// histogramSampled sends a histogram value sampled at rate to s, repeating it
+// if s does not support sample rates.
+func histogramSampled(s Sender, stat string, value, rate float64, tags []string) {
+	if ss, ok := s.(SampledSender); ok {
+		ss.HistogramSampled(stat, value, rate, tags...)
+		return
+	}
+	for i := repeat(rate); i > 0; i-- {
+		s.Histogram(stat, value, tags...)
+	}
+}
+
+// timingSampled sends a timing sampled at rate to s, repeating it if s does not
+// support sample rates.
+func timingSampled(s Sender, stat string, duration time.Duration, rate float64, tags []string) {
+	if ss, ok := s.(SampledSender); ok {
+		ss.TimingSampled(stat, duration, rate, tags...)
+		return
+	}
+	for i := repeat(rate); i > 0; i-- {
+		s.Timing(stat, duration, tags...)
+	}
+}
+
+// maxRepeat is the maximum number of times a sampled histogram value or
+// timing is repeated.
+const maxRepeat = 100
+
+// repeat returns the number of observations represented by one observation
+// sampled at rate, capped to maxRepeat.
+func repeat(rate float64) int {
+	if !(rate >= 1.0/maxRepeat) {
+		return maxRepeat
+	}
+	n := int(1/rate + 0.5)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// distribution sends a distribution value to s, or an histogram value if s does
+// not support distributions.
+func distribution(s Sender, stat string, value float64, tags []string) {
+	if ds, ok := s.(DistributionSender); ok {
+		ds.Distribution(stat, value, tags...)
+		return
+	}
+	s.Histogram(stat, value, tags...)
+}
@@ -43,3 +43,100 @@ func TestMultiSender(t *testing.T) {
 	assert.Equal(t, cmd{name: "Close"}, fs2.last)
 	assert.Equal(t, cmd{name: "Close"}, fs3.last)
 }
+
+func TestMultiSenderSampled(t *testing.T) {
+	fs1 := &fakeSender{}
+	fs2 := &fakeSampledSender{}
+	m := MultiSender{fs1, fs2}
+
+	m.CountSampled("foo", 1, 0.5, "bar")
+	assert.Equal(t, cmd{"Count", "foo", 2, []string{"bar"}}, fs1.last)
+	assert.Equal(t, cmd{"CountSampled", "foo", 1, []string{"bar"}}, fs2.last)
+	assert.Equal(t, 0.5, fs2.rate)
+
+	m.HistogramSampled("foo", 1, 0.5, "bar")
+	assert.Equal(t, cmd{"Histogram", "foo", 1, []string{"bar"}}, fs1.last)
+	assert.Equal(t, cmd{"HistogramSampled", "foo", 1, []string{"bar"}}, fs2.last)
+
+	m.TimingSampled("foo", 1*time.Second, 0.5, "bar")
+	assert.Equal(t, cmd{"Timing", "foo", 1, []string{"bar"}}, fs1.last)
+	assert.Equal(t, cmd{"TimingSampled", "foo", 1, []string{"bar"}}, fs2.last)
+}
+
+func TestSampledRepeat(t *testing.T) {
+	s := &countingSender{}
+	histogramSampled(s, "foo", 1, 0.25, nil)
+	assert.Equal(t, 4, s.n)
+	s.n = 0
+	histogramSampled(s, "foo", 1, 0.001, nil)
+	assert.Equal(t, maxRepeat, s.n)
+	s.n = 0
+	histogramSampled(s, "foo", 1, 0, nil)
+	assert.Equal(t, maxRepeat, s.n)
+}
+
+func TestMultiSenderTagPairs(t *testing.T) {
+	fs1 := &fakeSender{}
+	fs2 := &fakeTagSender{}
+	m := MultiSender{fs1, fs2}
+
+	m.GaugeT("foo", 1, Tag{"bar", "1"})
+	assert.Equal(t, cmd{"Gauge", "foo", 1, []string{"bar:1"}}, fs1.last)
+	assert.Equal(t, cmd{"GaugeT", "foo", 1, nil}, fs2.last)
+	assert.Equal(t, []Tag{{"bar", "1"}}, fs2.pairs)
+
+	m.CountT("foo", 1)
+	assert.Equal(t, cmd{"Count", "foo", 1, nil}, fs1.last)
+	assert.Equal(t, cmd{"CountT", "foo", 1, nil}, fs2.last)
+
+	m.HistogramT("foo", 1)
+	assert.Equal(t, cmd{"Histogram", "foo", 1, nil}, fs1.last)
+	assert.Equal(t, cmd{"HistogramT", "foo", 1, nil}, fs2.last)
+
+	m.TimingT("foo", time.Second)
+	assert.Equal(t, cmd{"Timing", "foo", 1, nil}, fs1.last)
+	assert.Equal(t, cmd{"TimingT", "foo", 1, nil}, fs2.last)
+}
+
+func TestMultiSenderSet(t *testing.T) {
+	fs1 := &fakeSender{}
+	fs2 := &fakeSetSender{}
+	m := MultiSender{fs1, fs2}
+
+	m.Set("foo", "user1", "bar")
+	assert.Equal(t, cmd{}, fs1.last)
+	assert.Equal(t, cmd{"Set", "foo", 0, []string{"bar"}}, fs2.last)
+	assert.Equal(t, "user1", fs2.value)
+}
+
+func TestMultiSenderGaugeDelta(t *testing.T) {
+	fs1 := &fakeSender{}
+	fs2 := &fakeGaugeDeltaSender{}
+	m := MultiSender{fs1, fs2}
+
+	m.GaugeDelta("foo", 2, "bar")
+	assert.Equal(t, cmd{}, fs1.last)
+	assert.Equal(t, cmd{"GaugeDelta", "foo", 2, []string{"bar"}}, fs2.last)
+}
+
+func TestMultiSenderDistribution(t *testing.T) {
+	fs1 := &fakeSender{}
+	fs2 := &fakeDistributionSender{}
+	m := MultiSender{fs1, fs2}
+
+	m.Distribution("foo", 1, "bar")
+	assert.Equal(t, cmd{"Histogram", "foo", 1, []string{"bar"}}, fs1.last)
+	assert.Equal(t, cmd{"Distribution", "foo", 1, []string{"bar"}}, fs2.last)
+}
+
+func TestMultiSenderEvent(t *testing.T) {
+	fs1 := &fakeSender{}
+	fs2 := &fakeEventSender{}
+	m := MultiSender{fs1, fs2}
+
+	m.Event(Event{Title: "foo"})
+	assert.Equal(t, Event{Title: "foo"}, fs2.event)
+	m.ServiceCheck(ServiceCheck{Name: "foo"})
+	assert.Equal(t, ServiceCheck{Name: "foo"}, fs2.serviceCheck)
+	assert.Equal(t, cmd{}, fs1.last)
+}
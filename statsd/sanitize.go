@@ -0,0 +1,41 @@
+package statsd
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sanitizer is the default xstats.Sanitizer of statsd senders. It replaces
+// the characters reserved by the statsd protocol (':', '|' and '@') and white
+// spaces in stat names with '_'. Tags are ignored by the protocol and left
+// untouched.
+type Sanitizer struct{}
+
+// Name implements xstats.Sanitizer interface
+func (Sanitizer) Name(stat string) string {
+	return strings.Map(replaceReserved, stat)
+}
+
+// Tag implements xstats.Sanitizer interface
+func (Sanitizer) Tag(tag string) string {
+	return tag
+}
+
+// Value implements xstats.ValueSanitizer interface - replaces ':', '|' and
+// new lines in set values with '_'.
+func (Sanitizer) Value(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ':' || r == '|' || r == '\n' || r == '\r' {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func replaceReserved(r rune) rune {
+	switch {
+	case r == ':' || r == '|' || r == '@' || unicode.IsSpace(r):
+		return '_'
+	}
+	return r
+}
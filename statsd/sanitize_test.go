@@ -0,0 +1,74 @@
+package statsd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizer(t *testing.T) {
+	s := Sanitizer{}
+	assert.Equal(t, "foo.bar-baz_1", s.Name("foo.bar-baz_1"))
+	assert.Equal(t, "foo_bar_baz_q_", s.Name("foo:bar|baz@q\n"))
+	assert.Equal(t, "a:b|c", s.Tag("a:b|c"))
+	assert.Equal(t, "user#1,2", s.Value("user#1,2"))
+	assert.Equal(t, "a_b_c_", s.Value("a:b|c\n"))
+}
+
+func TestSanitize(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Hour)
+	c.Count("foo:bar", 1)
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo_bar:1|c\n", buf.String())
+
+	buf.Reset()
+	c = NewOptions(buf, time.Hour, Sanitize(nil))
+	c.Count("foo bar", 1)
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo bar:1|c\n", buf.String())
+}
+
+func TestSanitizeSetValue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Hour).(xstats.SetSender)
+	c.Set("foo", "a|c\nbar:1|c")
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo:a_c_bar_1_c|s\n", buf.String())
+
+	buf.Reset()
+	var errs []error
+	c = NewOptions(buf, time.Hour, OnInvalidName(xstats.RejectInvalid), OnError(func(err error, dropped int, s string) {
+		errs = append(errs, err)
+	})).(xstats.SetSender)
+	c.Set("foo", "a\nb")
+	c.Set("foo", "b")
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo:b|s\n", buf.String())
+	assert.Equal(t, []error{&xstats.InvalidSetValueError{Stat: "foo", Value: "a\nb"}}, errs)
+}
+
+func TestOnInvalidName(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Hour, OnInvalidName(xstats.CountInvalid))
+	c.Count("foo:bar", 1)
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo:bar:1|c\n", buf.String())
+	assert.Equal(t, Stats{InvalidNames: 1}, c.(interface {
+		Stats() Stats
+	}).Stats())
+
+	buf.Reset()
+	var errs []error
+	c = NewOptions(buf, time.Hour, OnInvalidName(xstats.RejectInvalid), OnError(func(err error, dropped int, s string) {
+		errs = append(errs, err)
+	}))
+	c.Count("foo:bar", 1)
+	c.Count("foo", 1)
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo:1|c\n", buf.String())
+	assert.Equal(t, []error{&xstats.InvalidNameError{Stat: "foo:bar"}}, errs)
+}
@@ -0,0 +1,134 @@
+package xstats
+
+import (
+	"strings"
+	"time"
+)
+
+// Tag is a structured tag, sent as "key:value" to senders using the string
+// form of tags.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// String returns the "key:value" form of the tag, or its key alone if it has
+// no value.
+func (t Tag) String() string {
+	if t.Value == "" {
+		return t.Key
+	}
+	return t.Key + ":" + t.Value
+}
+
+// ParseTag parses a tag in the "key:value" form. A tag without colon has an
+// empty value.
+func ParseTag(tag string) Tag {
+	if i := strings.IndexByte(tag, ':'); i >= 0 {
+		return Tag{Key: tag[:i], Value: tag[i+1:]}
+	}
+	return Tag{Key: tag}
+}
+
+// TagStrings returns the string form of tags.
+func TagStrings(tags []Tag) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	s := make([]string, len(tags))
+	for i, t := range tags {
+		s[i] = t.String()
+	}
+	return s
+}
+
+// parseTags parses tags in the string form.
+func parseTags(tags []string) []Tag {
+	if len(tags) == 0 {
+		return nil
+	}
+	t := make([]Tag, len(tags))
+	for i, tag := range tags {
+		t[i] = ParseTag(tag)
+	}
+	return t
+}
+
+// SanitizeTagPairs is like Sanitize for structured tags. The tags are checked
+// in their string form and only copied if one of them is rewritten.
+func SanitizeTagPairs(s Sanitizer, stat string, tags []Tag) (string, []Tag, bool) {
+	name := s.Name(stat)
+	var sanitized []Tag
+	for i, tag := range tags {
+		str := tag.String()
+		if t := s.Tag(str); t != str {
+			if sanitized == nil {
+				sanitized = append([]Tag(nil), tags...)
+			}
+			sanitized[i] = ParseTag(t)
+		}
+	}
+	if sanitized == nil {
+		return name, tags, name == stat
+	}
+	return name, sanitized, false
+}
+
+// TagSender is an optional interface for Sender supporting structured tags,
+// saving the parsing of their string form. Observations with structured tags
+// are sent with their string form to a Sender not implementing it.
+type TagSender interface {
+	Sender
+
+	// GaugeT is like Gauge with structured tags.
+	GaugeT(stat string, value float64, tags ...Tag)
+
+	// CountT is like Count with structured tags.
+	CountT(stat string, count float64, tags ...Tag)
+
+	// HistogramT is like Histogram with structured tags.
+	HistogramT(stat string, value float64, tags ...Tag)
+
+	// TimingT is like Timing with structured tags.
+	TimingT(stat string, value time.Duration, tags ...Tag)
+}
+
+// gaugeT sends a gauge with structured tags to s, in their string form if s
+// does not support them.
+func gaugeT(s Sender, stat string, value float64, tags []Tag) {
+	if ts, ok := s.(TagSender); ok {
+		ts.GaugeT(stat, value, tags...)
+		return
+	}
+	s.Gauge(stat, value, TagStrings(tags)...)
+}
+
+// countT sends a count with structured tags to s, in their string form if s
+// does not support them.
+func countT(s Sender, stat string, count float64, tags []Tag) {
+	if ts, ok := s.(TagSender); ok {
+		ts.CountT(stat, count, tags...)
+		return
+	}
+	s.Count(stat, count, TagStrings(tags)...)
+}
+
+// histogramT sends a histogram value with structured tags to s, in their
+// string form if s does not support them.
+func histogramT(s Sender, stat string, value float64, tags []Tag) {
+	if ts, ok := s.(TagSender); ok {
+		ts.HistogramT(stat, value, tags...)
+		return
+	}
+	s.Histogram(stat, value, TagStrings(tags)...)
+}
+
+// timingT sends a timing with structured tags to s, in their string form if s
+// does not support them.
+func timingT(s Sender, stat string, duration time.Duration, tags []Tag) {
+	if ts, ok := s.(TagSender); ok {
+		ts.TimingT(stat, duration, tags...)
+		return
+	}
+	s.Timing(stat, duration, TagStrings(tags)...)
+}
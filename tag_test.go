@@ -0,0 +1,36 @@
+package xstats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagString(t *testing.T) {
+	assert.Equal(t, "foo:bar", Tag{"foo", "bar"}.String())
+	assert.Equal(t, "foo", Tag{Key: "foo"}.String())
+}
+
+func TestParseTag(t *testing.T) {
+	assert.Equal(t, Tag{"foo", "bar:baz"}, ParseTag("foo:bar:baz"))
+	assert.Equal(t, Tag{Key: "foo"}, ParseTag("foo"))
+}
+
+func TestTagStrings(t *testing.T) {
+	assert.Nil(t, TagStrings(nil))
+	assert.Equal(t, []string{"foo:bar", "baz"}, TagStrings([]Tag{{"foo", "bar"}, {Key: "baz"}}))
+}
+
+func TestSanitizeTagPairs(t *testing.T) {
+	tags := []Tag{{"a", "b"}, {"c", "d"}}
+	stat, sanitized, valid := SanitizeTagPairs(dashSanitizer{}, "foo", tags)
+	assert.True(t, valid)
+	assert.Equal(t, "foo", stat)
+	assert.Equal(t, &tags[0], &sanitized[0])
+
+	tags = []Tag{{"a", "b"}, {"c-d", "e-f"}}
+	_, sanitized, valid = SanitizeTagPairs(dashSanitizer{}, "foo", tags)
+	assert.False(t, valid)
+	assert.Equal(t, []Tag{{"a", "b"}, {"c_d", "e_f"}}, sanitized)
+	assert.Equal(t, Tag{"c-d", "e-f"}, tags[1])
+}
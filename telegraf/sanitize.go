@@ -0,0 +1,83 @@
+package telegraf
+
+import (
+	"strings"
+)
+
+// Sanitizer is the default xstats.Sanitizer of telegraf senders. It escapes
+// the characters splitting measurements and tags in the InfluxDB line
+// protocol with a backslash (',' and ' ' in stat names, plus '=' in tag keys
+// and values) and replaces the characters reserved by the statsd protocol
+// (':', '|', '@' and new lines) with '_'. The first ':' of a tag separates its
+// key from its value.
+type Sanitizer struct{}
+
+// Name implements xstats.Sanitizer interface
+func (Sanitizer) Name(stat string) string {
+	return sanitize(stat, ", ")
+}
+
+// Tag implements xstats.Sanitizer interface
+func (Sanitizer) Tag(tag string) string {
+	i := strings.IndexByte(tag, ':')
+	if i < 0 {
+		return sanitize(tag, ",= ")
+	}
+	k, v := tag[:i], tag[i+1:]
+	if sk, sv := sanitize(k, ",= "), sanitize(v, ",= "); sk != k || sv != v {
+		return sk + ":" + sv
+	}
+	return tag
+}
+
+// Value implements xstats.ValueSanitizer interface - replaces ':', '|', ','
+// and new lines in set values with '_'.
+func (Sanitizer) Value(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ':' || r == '|' || r == ',' || r == '\n' || r == '\r' {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// sanitize escapes the characters of s in escaped and replaces the reserved
+// ones. Characters already escaped are left as is. It only allocates if s is
+// changed.
+func sanitize(s, escaped string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			if b != nil {
+				b = append(b, c, s[i+1])
+			}
+			i++
+			continue
+		case strings.IndexByte(escaped, c) >= 0:
+			b = grow(b, s, i)
+			b = append(b, '\\', c)
+			continue
+		case c == ':' || c == '|' || c == '@' || c == '\n' || c == '\r':
+			b = grow(b, s, i)
+			b = append(b, '_')
+			continue
+		}
+		if b != nil {
+			b = append(b, c)
+		}
+	}
+	if b == nil {
+		return s
+	}
+	return string(b)
+}
+
+// grow returns b, or a copy of s up to i if b is nil.
+func grow(b []byte, s string, i int) []byte {
+	if b != nil {
+		return b
+	}
+	return append(make([]byte, 0, len(s)+4), s[:i]...)
+}
@@ -0,0 +1,39 @@
+package telegraf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/xstats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizer(t *testing.T) {
+	s := Sanitizer{}
+	assert.Equal(t, "foo.bar-baz_1", s.Name("foo.bar-baz_1"))
+	assert.Equal(t, `foo\,bar\ baz_q_`, s.Name("foo,bar baz:q|"))
+	assert.Equal(t, `foo\,bar`, s.Name(`foo\,bar`))
+	assert.Equal(t, "env:prod", s.Tag("env:prod"))
+	assert.Equal(t, `a\=b:c\,d_e`, s.Tag("a=b:c,d:e"))
+	assert.Equal(t, `a\=b`, s.Tag("a=b"))
+	assert.Equal(t, "user=1", s.Value("user=1"))
+	assert.Equal(t, "a_b_c_d_", s.Value("a|b:c,d\n"))
+}
+
+func TestSanitize(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Hour)
+	c.Count("foo,bar", 1, "env:prod", "a:b=c")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, `foo\,bar,env=prod,a=b\=c:1|c`+"\n", buf.String())
+}
+
+func TestSanitizeSetValue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Hour).(xstats.SetSender)
+	c.Set("foo", "a,b:1|c", "env:prod")
+	xstats.CloseSender(c)
+	assert.Equal(t, "foo,env=prod:a_b_1_c|s\n", buf.String())
+}
@@ -2,22 +2,21 @@
 package telegraf
 
 import (
-	"bytes"
-	"fmt"
 	"io"
-	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/xstats"
+	"github.com/rs/xstats/internal/transport"
 )
 
 // Inspired by https://github.com/streadway/handy statsd package
 
 type sender struct {
-	c    chan string
-	quit chan struct{}
-	done chan struct{}
+	t *transport.Transport
+	// agg aggregates observations when enabled with Aggregate.
+	agg *transport.Aggregator
 }
 
 // defaultMaxPacketLen is the default number of bytes filled before a packet is
@@ -39,90 +38,384 @@ func New(w io.Writer, reportInterval time.Duration) xstats.Sender {
 // report interval or until the buffer exceeds the max packet size, whichever
 // comes first.
 func NewMaxPacket(w io.Writer, reportInterval time.Duration, maxPacketLen int) xstats.Sender {
-	s := &sender{
-		c:    make(chan string),
-		quit: make(chan struct{}),
-		done: make(chan struct{}),
+	return NewOptions(w, reportInterval, MaxPacketLen(maxPacketLen))
+}
+
+// NewOptions creates a telegraf statsd sender that emits observations in the
+// statsd protocol to the passed writer, configured with the given options.
+// Observations are queued and never block the caller unless the Block policy
+// is selected.
+//
+// The returned sender implements interface{ Stats() Stats } to report the
+// observations it dropped and the packets it failed to write.
+func NewOptions(w io.Writer, reportInterval time.Duration, opts ...Option) xstats.Sender {
+	o := transport.Options{
+		MaxPacketLen: defaultMaxPacketLen,
+		Tick:         tick,
+		Name:         "telegraf",
+		Sanitizer:    Sanitizer{},
+		Format:       format,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	t := transport.New(w, reportInterval, o)
+	return &sender{t: t, agg: t.Aggregator()}
+}
+
+// Option configures a sender created with NewOptions.
+type Option func(*transport.Options)
+
+// Policy defines what a sender does with an observation when its queue is full.
+type Policy int
+
+const (
+	// DropNewest discards the observation being sent. This is the default.
+	DropNewest = Policy(transport.DropNewest)
+	// DropOldest discards the oldest queued observation.
+	DropOldest = Policy(transport.DropOldest)
+	// Block waits for the queue to have room, stalling the caller.
+	Block = Policy(transport.Block)
+)
+
+// MaxPacketLen sets the number of bytes filled before a packet is flushed
+// before the reporting interval.
+func MaxPacketLen(n int) Option {
+	return func(o *transport.Options) {
+		o.MaxPacketLen = n
+	}
+}
+
+// QueueSize sets the number of observations queued ahead of the writer.
+func QueueSize(n int) Option {
+	return func(o *transport.Options) {
+		o.QueueSize = n
+	}
+}
+
+// OnQueueFull sets the policy applied to observations sent while the queue
+// is full.
+func OnQueueFull(p Policy) Option {
+	return func(o *transport.Options) {
+		o.Policy = transport.Policy(p)
+	}
+}
+
+// OnError sets the function called when a packet could not be written or an
+// observation was rejected, like a NaN value reported with an
+// *xstats.InvalidValueError. The handler receives the error, the number of
+// bytes lost and the name of the sender ("telegraf"). It must not block as it is
+// called from the sender's goroutine for write errors and from the caller's
+// for rejected observations. By default errors are logged with the log
+// package.
+func OnError(h func(err error, dropped int, sender string)) Option {
+	return func(o *transport.Options) {
+		o.OnError = h
+	}
+}
+
+// Aggregate sums counts, keeps the last gauge value and deduplicates set
+// values over the report interval, sending a single line per stat, type and
+// tags.
+func Aggregate() Option {
+	return func(o *transport.Options) {
+		o.Aggregate = true
+	}
+}
+
+// AggregateHistograms enables Aggregate and also buffers histograms and
+// timings over the report interval, sending their values in multi-value lines
+// like "name,tag=v:1:2:3|h". Sampled observations are sent as is.
+func AggregateHistograms() Option {
+	return func(o *transport.Options) {
+		o.Aggregate = true
+		o.AggregateHistograms = true
+	}
+}
+
+// Sanitize sets the sanitizer rewriting stat names and tags, Sanitizer by
+// default. A nil sanitizer disables sanitization.
+func Sanitize(sanitizer xstats.Sanitizer) Option {
+	return func(o *transport.Options) {
+		o.Sanitizer = sanitizer
+	}
+}
+
+// OnInvalidName sets the policy applied to observations with a name or tag
+// changed by the sanitizer. Rejected observations are reported to the OnError
+// handler with an *xstats.InvalidNameError.
+func OnInvalidName(p xstats.SanitizePolicy) Option {
+	return func(o *transport.Options) {
+		o.SanitizePolicy = p
+	}
+}
+
+// Stats holds the counters of a sender.
+type Stats struct {
+	// Dropped is the number of observations discarded because the queue was full.
+	Dropped uint64
+	// WriteErrors is the number of packets the writer failed to write.
+	WriteErrors uint64
+	// DroppedBytes is the number of bytes lost with those packets.
+	DroppedBytes uint64
+	// InvalidNames is the number of observations with an invalid name or tag
+	// counted or rejected.
+	InvalidNames uint64
+}
+
+// Stats returns the sender's counters.
+func (s *sender) Stats() Stats {
+	return Stats{
+		Dropped:      s.t.Dropped(),
+		WriteErrors:  s.t.WriteErrors(),
+		DroppedBytes: s.t.DroppedBytes(),
+		InvalidNames: s.t.Invalid(),
 	}
-	go s.fwd(w, reportInterval, maxPacketLen)
-	return s
 }
 
 // Gauge implements xstats.Sender interface
 func (s *sender) Gauge(stat string, value float64, tags ...string) {
-	s.c <- fmt.Sprintf("%s,%s:%f|g\n", stat, t(tags), value)
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok || !s.t.Valid(stat, value) {
+		return
+	}
+	if s.agg != nil {
+		s.agg.Gauge(stat, value, tags)
+		return
+	}
+	s.send(stat, value, "g", 0, tags)
 }
 
 // Count implements xstats.Sender interface
 func (s *sender) Count(stat string, count float64, tags ...string) {
-	s.c <- fmt.Sprintf("%s,%s:%f|c\n", stat, t(tags), count)
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok || !s.t.Valid(stat, count) {
+		return
+	}
+	if s.agg != nil {
+		s.agg.Count(stat, count, tags)
+		return
+	}
+	s.send(stat, count, "c", 0, tags)
 }
 
 // Histogram implements xstats.Sender interface
 func (s *sender) Histogram(stat string, value float64, tags ...string) {
-	s.c <- fmt.Sprintf("%s,%s:%f|h\n", stat, t(tags), value)
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok || !s.t.Valid(stat, value) {
+		return
+	}
+	if s.agg != nil && s.agg.Sample(stat, "h", value, tags) {
+		return
+	}
+	s.send(stat, value, "h", 0, tags)
 }
 
 // Timing implements xstats.Sender interface
 func (s *sender) Timing(stat string, duration time.Duration, tags ...string) {
-	s.c <- fmt.Sprintf("%s,%s:%f|ms\n", stat, t(tags), duration.Seconds())
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok {
+		return
+	}
+	if s.agg != nil && s.agg.Sample(stat, "ms", duration.Seconds(), tags) {
+		return
+	}
+	s.send(stat, duration.Seconds(), "ms", 0, tags)
 }
 
-// Close implements xstats.Sender interface
-func (s *sender) Close() error {
-	close(s.quit)
-	<-s.done
-	close(s.c)
+// GaugeDelta implements xstats.GaugeDeltaSender interface
+func (s *sender) GaugeDelta(stat string, delta float64, tags ...string) {
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok || !s.t.Valid(stat, delta) {
+		return
+	}
+	if s.agg != nil {
+		s.agg.GaugeDelta(stat, delta, tags)
+		return
+	}
+	b := transport.GetBuffer()
+	b.B = append(b.B, stat...)
+	b.B = append(b.B, ',')
+	b.B = appendTags(b.B, tags)
+	b.B = append(b.B, ':')
+	b.B = transport.AppendDelta(b.B, delta)
+	b.B = append(b.B, "|g\n"...)
+	s.t.SendBuffer(b)
+}
+
+// Set implements xstats.SetSender interface
+func (s *sender) Set(stat string, value string, tags ...string) {
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok {
+		return
+	}
+	if value, ok = s.t.SanitizeValue(stat, value); !ok {
+		return
+	}
+	if s.agg != nil {
+		s.agg.Set(stat, value, tags)
+		return
+	}
+	b := transport.GetBuffer()
+	b.B = append(b.B, stat...)
+	b.B = append(b.B, ',')
+	b.B = appendTags(b.B, tags)
+	b.B = append(b.B, ':')
+	b.B = append(b.B, value...)
+	b.B = append(b.B, "|s\n"...)
+	s.t.SendBuffer(b)
+}
 
-	return nil
+// GaugeT implements xstats.TagSender interface
+func (s *sender) GaugeT(stat string, value float64, tags ...xstats.Tag) {
+	if s.agg != nil {
+		s.Gauge(stat, value, xstats.TagStrings(tags)...)
+		return
+	}
+	stat, tags, ok := s.t.SanitizeTagPairs(stat, tags)
+	if !ok || !s.t.Valid(stat, value) {
+		return
+	}
+	s.sendT(stat, value, "g", tags)
+}
+
+// CountT implements xstats.TagSender interface
+func (s *sender) CountT(stat string, count float64, tags ...xstats.Tag) {
+	if s.agg != nil {
+		s.Count(stat, count, xstats.TagStrings(tags)...)
+		return
+	}
+	stat, tags, ok := s.t.SanitizeTagPairs(stat, tags)
+	if !ok || !s.t.Valid(stat, count) {
+		return
+	}
+	s.sendT(stat, count, "c", tags)
+}
+
+// HistogramT implements xstats.TagSender interface
+func (s *sender) HistogramT(stat string, value float64, tags ...xstats.Tag) {
+	if s.agg != nil {
+		s.Histogram(stat, value, xstats.TagStrings(tags)...)
+		return
+	}
+	stat, tags, ok := s.t.SanitizeTagPairs(stat, tags)
+	if !ok || !s.t.Valid(stat, value) {
+		return
+	}
+	s.sendT(stat, value, "h", tags)
 }
 
-// Generate a telegraf tag suffix
-func t(tags []string) string {
-	for i, v := range tags {
-		tags[i] = strings.Replace(v, ":", "=", 1)
+// TimingT implements xstats.TagSender interface
+func (s *sender) TimingT(stat string, duration time.Duration, tags ...xstats.Tag) {
+	if s.agg != nil {
+		s.Timing(stat, duration, xstats.TagStrings(tags)...)
+		return
 	}
-	t := ""
-	if len(tags) > 0 {
-		t = "" + strings.Join(tags, ",")
+	stat, tags, ok := s.t.SanitizeTagPairs(stat, tags)
+	if !ok {
+		return
 	}
-	return t
+	s.sendT(stat, duration.Seconds(), "ms", tags)
 }
 
-func (s *sender) fwd(w io.Writer, reportInterval time.Duration, maxPacketLen int) {
-	defer close(s.done)
+// CountSampled implements xstats.SampledSender interface
+func (s *sender) CountSampled(stat string, count float64, rate float64, tags ...string) {
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok || !s.t.Valid(stat, count) {
+		return
+	}
+	if s.agg != nil {
+		s.agg.Count(stat, count/rate, tags)
+		return
+	}
+	s.send(stat, count, "c", rate, tags)
+}
 
-	buf := &bytes.Buffer{}
-	tick := tick(reportInterval)
-	for {
-		select {
-		case m := <-s.c:
-			newLen := buf.Len() + len(m)
-			if newLen > maxPacketLen {
-				flush(w, buf)
-			}
+// HistogramSampled implements xstats.SampledSender interface
+func (s *sender) HistogramSampled(stat string, value float64, rate float64, tags ...string) {
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok || !s.t.Valid(stat, value) {
+		return
+	}
+	s.send(stat, value, "h", rate, tags)
+}
 
-			buf.Write([]byte(m))
+// TimingSampled implements xstats.SampledSender interface
+func (s *sender) TimingSampled(stat string, duration time.Duration, rate float64, tags ...string) {
+	stat, tags, ok := s.t.Sanitize(stat, tags)
+	if !ok {
+		return
+	}
+	s.send(stat, duration.Seconds(), "ms", rate, tags)
+}
 
-			if newLen == maxPacketLen {
-				flush(w, buf)
-			}
+// send formats a line in a pooled buffer and queues it. The sample rate is
+// omitted if 0.
+func (s *sender) send(stat string, value float64, typ string, rate float64, tags []string) {
+	b := transport.GetBuffer()
+	b.B = append(b.B, stat...)
+	b.B = append(b.B, ',')
+	b.B = appendTags(b.B, tags)
+	s.sendValue(b, value, typ, rate)
+}
 
-		case <-tick:
-			flush(w, buf)
-		case <-s.quit:
-			flush(w, buf)
-			return
+// sendT is like send with structured tags.
+func (s *sender) sendT(stat string, value float64, typ string, tags []xstats.Tag) {
+	b := transport.GetBuffer()
+	b.B = append(b.B, stat...)
+	b.B = append(b.B, ',')
+	for i, tag := range tags {
+		if i > 0 {
+			b.B = append(b.B, ',')
+		}
+		b.B = append(b.B, tag.Key...)
+		if tag.Value != "" {
+			b.B = append(b.B, '=')
+			b.B = append(b.B, tag.Value...)
 		}
 	}
+	s.sendValue(b, value, typ, 0)
 }
 
-func flush(w io.Writer, buf *bytes.Buffer) {
-	if buf.Len() <= 0 {
-		return
+// sendValue appends the value of a line to b and queues it.
+func (s *sender) sendValue(b *transport.Buffer, value float64, typ string, rate float64) {
+	b.B = append(b.B, ':')
+	b.B = transport.AppendValue(b.B, value)
+	b.B = append(b.B, '|')
+	b.B = append(b.B, typ...)
+	if rate != 0 {
+		b.B = append(b.B, "|@"...)
+		b.B = strconv.AppendFloat(b.B, rate, 'f', -1, 64)
 	}
-	if _, err := w.Write(buf.Bytes()); err != nil {
-		log.Printf("error: could not write to statsd: %v", err)
+	b.B = append(b.B, '\n')
+	s.t.SendBuffer(b)
+}
+
+// Close implements xstats.Sender interface
+func (s *sender) Close() error {
+	return s.t.Close()
+}
+
+// format formats an aggregated line.
+func format(stat, typ string, values []string, tags []string) string {
+	b := append([]byte(stat), ',')
+	b = appendTags(b, tags)
+	return string(b) + ":" + strings.Join(values, ":") + "|" + typ + "\n"
+}
+
+// appendTags appends the tags to b, separated by commas, using the telegraf
+// "key=value" form for "key:value" tags.
+func appendTags(b []byte, tags []string) []byte {
+	for i, tag := range tags {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if j := strings.IndexByte(tag, ':'); j >= 0 {
+			b = append(b, tag[:j]...)
+			b = append(b, '=')
+			tag = tag[j+1:]
+		}
+		b = append(b, tag...)
 	}
-	buf.Reset()
+	return b
 }
@@ -3,11 +3,14 @@ package telegraf
 import (
 	"bytes"
 	"errors"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/rs/xstats"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,7 +35,7 @@ func TestCounter(t *testing.T) {
 	c.Count("metric2", 2, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1,tag1:1.000000|c\nmetric2,tag1,tag2:2.000000|c\n", buf.String())
+	assert.Equal(t, "metric1,tag1:1|c\nmetric2,tag1,tag2:2|c\n", buf.String())
 }
 
 func TestGauge(t *testing.T) {
@@ -46,7 +49,7 @@ func TestGauge(t *testing.T) {
 	c.Gauge("metric2", -2.0, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1,tag1:1.000000|g\nmetric2,tag1,tag2:-2.000000|g\n", buf.String())
+	assert.Equal(t, "metric1,tag1:1|g\nmetric2,tag1,tag2:-2|g\n", buf.String())
 }
 
 func TestHistogram(t *testing.T) {
@@ -60,7 +63,7 @@ func TestHistogram(t *testing.T) {
 	c.Histogram("metric2", 2, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1,tag1:1.000000|h\nmetric2,tag1,tag2:2.000000|h\n", buf.String())
+	assert.Equal(t, "metric1,tag1:1|h\nmetric2,tag1,tag2:2|h\n", buf.String())
 }
 
 func TestTiming(t *testing.T) {
@@ -74,21 +77,56 @@ func TestTiming(t *testing.T) {
 	c.Timing("metric2", 2*time.Second, "tag1", "tag2")
 	wait(buf)
 
-	assert.Equal(t, "metric1,tag1:1.000000|ms\nmetric2,tag1,tag2:2.000000|ms\n", buf.String())
+	assert.Equal(t, "metric1,tag1:1|ms\nmetric2,tag1,tag2:2|ms\n", buf.String())
+}
+
+func TestSet(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.SetSender)
+
+	c.Set("metric1", "user1", "tag1")
+	c.Set("metric2", "user2", "tag1", "tag2")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1,tag1:user1|s\nmetric2,tag1,tag2:user2|s\n", buf.String())
+}
+
+func TestGaugeDelta(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.GaugeDeltaSender)
+
+	c.GaugeDelta("metric1", 1, "tag1")
+	c.GaugeDelta("metric1", -2.5, "tag1", "tag2")
+	c.GaugeDelta("metric2", 0)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1,tag1:+1|g\nmetric1,tag1,tag2:-2.5|g\nmetric2,:+0|g\n", buf.String())
+}
+
+func TestSampled(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Second).(xstats.SampledSender)
+
+	c.CountSampled("metric1", 1, 0.5, "tag1")
+	c.HistogramSampled("metric2", 2, 0.1, "tag1", "tag2")
+	c.TimingSampled("metric3", time.Second, 0.25)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1,tag1:1|c|@0.5\nmetric2,tag1,tag2:2|h|@0.1\nmetric3,:1|ms|@0.25\n", buf.String())
 }
 
 func TestMaxPacketLen(t *testing.T) {
 	buf := &bytes.Buffer{}
-	c := NewMaxPacket(buf, time.Hour, 32)
+	c := NewMaxPacket(buf, time.Hour, 18)
 
-	c.Count("metric1", 1.0) // len("metric1,:1.000000|c\n") == 20
-	c.Count("mt2", 1.0)     // len == 16
+	c.Count("metric1", 1.0) // len("metric1,:1|c\n") == 13
+	c.Count("mt2", 1.0)     // len == 9
 
 	for i := 0; i < 10 && buf.Len() == 0; i++ {
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	assert.Equal(t, "metric1,:1.000000|c\n", buf.String())
+	assert.Equal(t, "metric1,:1|c\n", buf.String())
 	buf.Reset()
 
 	c.Count("mt3", 1.0)
@@ -96,7 +134,20 @@ func TestMaxPacketLen(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	assert.Equal(t, "mt2,:1.000000|c\nmt3,:1.000000|c\n", buf.String())
+	assert.Equal(t, "mt2,:1|c\nmt3,:1|c\n", buf.String())
+}
+
+func TestNewOptions(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Hour, QueueSize(10), OnQueueFull(DropOldest))
+
+	c.Count("metric1", 1.0)
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1,:1|c\n", buf.String())
+	assert.Equal(t, Stats{}, c.(interface {
+		Stats() Stats
+	}).Stats())
 }
 
 type errWriter struct{}
@@ -118,5 +169,101 @@ func TestInvalidBuffer(t *testing.T) {
 	c.Count("metric", 1)
 	wait(buf)
 
-	assert.Contains(t, buf.String(), "error: could not write to statsd: i/o error")
+	assert.Contains(t, buf.String(), "error: could not write to telegraf: i/o error")
+}
+
+func TestOnError(t *testing.T) {
+	var sender string
+	errs := make(chan error, 1)
+	c := NewOptions(&errWriter{}, time.Hour, OnError(func(err error, dropped int, s string) {
+		sender = s
+		errs <- err
+	}))
+
+	c.Count("metric", 1)
+	xstats.CloseSender(c)
+
+	assert.EqualError(t, <-errs, "i/o error")
+	assert.Equal(t, "telegraf", sender)
+	assert.Equal(t, Stats{WriteErrors: 1, DroppedBytes: 12}, c.(interface {
+		Stats() Stats
+	}).Stats())
+}
+
+func TestAggregate(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewOptions(buf, time.Hour, AggregateHistograms()).(xstats.SampledSender)
+
+	c.Count("metric1", 1, "tag:1")
+	c.Count("metric1", 2, "tag:1")
+	c.Gauge("metric2", 1, "tag:1")
+	c.Gauge("metric2", 3, "tag:1")
+	c.Histogram("metric3", 1, "tag:1")
+	c.Histogram("metric3", 2, "tag:1")
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1,tag=1:3|c\n"+
+		"metric2,tag=1:3|g\n"+
+		"metric3,tag=1:1:2|h\n", buf.String())
+}
+
+func BenchmarkCount(b *testing.B) {
+	c := New(ioutil.Discard, time.Hour)
+	defer xstats.CloseSender(c)
+	tags := []string{"tag1:a", "tag2:b"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Count("metric1", 1, tags...)
+	}
+}
+
+func BenchmarkTiming(b *testing.B) {
+	c := New(ioutil.Discard, time.Hour)
+	defer xstats.CloseSender(c)
+	tags := []string{"tag1:a", "tag2:b"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Timing("metric1", 42*time.Millisecond, tags...)
+	}
+}
+
+func TestValues(t *testing.T) {
+	buf := &bytes.Buffer{}
+	var errs []error
+	c := NewOptions(buf, time.Hour, OnError(func(err error, dropped int, s string) {
+		errs = append(errs, err)
+	}))
+
+	c.Gauge("metric1", 0.000001234)
+	c.Gauge("metric1", 12345678901)
+	c.Gauge("metric1", -0.5)
+	c.Gauge("metric2", math.NaN())
+	c.Count("metric2", math.Inf(1))
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1,:0.000001234|g\nmetric1,:12345678901|g\nmetric1,:-0.5|g\n", buf.String())
+	if assert.Len(t, errs, 2) {
+		assert.EqualError(t, errs[0], "xstats: invalid value NaN for metric2")
+		assert.Equal(t, &xstats.InvalidValueError{Stat: "metric2", Value: math.Inf(1)}, errs[1])
+	}
+}
+
+func TestTagPairs(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := New(buf, time.Hour).(xstats.TagSender)
+
+	c.GaugeT("metric1", 1, xstats.Tag{Key: "tag1", Value: "a"}, xstats.Tag{Key: "tag2"})
+	c.CountT("metric2", 2, xstats.Tag{Key: "tag1", Value: "a,b"})
+	c.HistogramT("metric3", 3)
+	c.TimingT("metric4", time.Second, xstats.Tag{Key: "tag1", Value: "a"})
+	xstats.CloseSender(c)
+
+	assert.Equal(t, "metric1,tag1=a,tag2:1|g\n"+
+		"metric2,tag1=a\\,b:2|c\n"+
+		"metric3,:3|h\n"+
+		"metric4,tag1=a:1|ms\n", buf.String())
 }
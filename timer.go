@@ -0,0 +1,85 @@
+package xstats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// now returns the current time, replaced in tests.
+var now = time.Now
+
+// Timer measures the duration of an operation, sent as a timing when the
+// timer is stopped. Only the first stop of a timer sends its timing, stopping
+// it again or stopping a copy does nothing, even once its pooled state is
+// reused by another timer. Timers don't allocate.
+type Timer struct {
+	t   *timer
+	gen uint64
+}
+
+// timer is the pooled state of a Timer.
+type timer struct {
+	// gen is incremented when the timer is stopped so the Timer values of
+	// previous uses can't stop it once reused. It is first to keep it 64-bit
+	// aligned for atomic operations.
+	gen   uint64
+	s     Sender
+	stat  string
+	tags  []string
+	start time.Time
+}
+
+var timerPool = &sync.Pool{
+	New: func() interface{} {
+		return &timer{}
+	},
+}
+
+// startTimer returns a timer sending the timing of stat to s.
+func startTimer(s Sender, stat string, tags []string) Timer {
+	t := timerPool.Get().(*timer)
+	t.s = s
+	t.stat = stat
+	// Copy the tags so the caller's slice doesn't escape, reusing the buffer
+	// of the previous uses of the timer
+	t.tags = append(t.tags[:0], tags...)
+	t.start = now()
+	return Timer{t: t, gen: atomic.LoadUint64(&t.gen)}
+}
+
+// Elapsed returns the duration since the timer was started, 0 once stopped.
+func (t Timer) Elapsed() time.Duration {
+	if t.t == nil || atomic.LoadUint64(&t.t.gen) != t.gen {
+		return 0
+	}
+	return now().Sub(t.t.start)
+}
+
+// Stop sends the duration since the timer was started as a timing and
+// returns it.
+func (t Timer) Stop() time.Duration {
+	return t.StopWithTags()
+}
+
+// StopWithTags is like Stop, adding tags to the ones given to StartTimer. It
+// returns 0 if the timer is already stopped.
+func (t Timer) StopWithTags(tags ...string) time.Duration {
+	if t.t == nil || !atomic.CompareAndSwapUint64(&t.t.gen, t.gen, t.gen+1) {
+		return 0
+	}
+	tm := t.t
+	d := now().Sub(tm.start)
+	tm.tags = append(tm.tags, tags...)
+	tm.s.Timing(tm.stat, d, tm.tags...)
+	tm.s = nil
+	timerPool.Put(tm)
+	return d
+}
+
+// timeFunc calls f, sending its duration as a timing of stat to s.
+func timeFunc(s Sender, stat string, f func(), tags []string) {
+	t := startTimer(s, stat, tags)
+	f()
+	t.Stop()
+}
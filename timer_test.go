@@ -0,0 +1,121 @@
+package xstats
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeNow returns a clock advancing by a second each time it is read.
+func fakeNow() func() time.Time {
+	t := time.Unix(0, 0)
+	return func() time.Time {
+		t = t.Add(time.Second)
+		return t
+	}
+}
+
+func TestTimer(t *testing.T) {
+	now = fakeNow()
+	defer func() { now = time.Now }()
+
+	s := &fakeSender{}
+	xs := NewPrefix(s, "prefix.")
+	xs.AddTags("foo")
+
+	tm := xs.StartTimer("metric", "bar")
+	assert.Equal(t, time.Second, tm.Elapsed())
+	assert.Equal(t, 2*time.Second, tm.Stop())
+	assert.Equal(t, cmd{"Timing", "prefix.metric", 2, []string{"bar", "foo"}}, s.last)
+
+	tm = xs.StartTimer("metric")
+	assert.Equal(t, time.Second, tm.StopWithTags("baz"))
+	assert.Equal(t, cmd{"Timing", "prefix.metric", 1, []string{"baz", "foo"}}, s.last)
+}
+
+func TestTimeFunc(t *testing.T) {
+	now = fakeNow()
+	defer func() { now = time.Now }()
+
+	s := &fakeSender{}
+	xs := New(s)
+	called := false
+	xs.TimeFunc("metric", func() {
+		called = true
+		s.last = cmd{}
+	}, "bar")
+
+	assert.True(t, called)
+	assert.Equal(t, cmd{"Timing", "metric", 1, []string{"bar"}}, s.last)
+}
+
+func TestTimerTags(t *testing.T) {
+	s := &fakeSender{}
+	xs := New(s)
+	xs.StartTimer("metric", "x:1", "x:2").Stop()
+	assert.Equal(t, []string{"x:1", "x:2"}, s.last.tags)
+	xs.StartTimer("metric", "y:2").StopWithTags("z:3")
+	assert.Equal(t, []string{"y:2", "z:3"}, s.last.tags)
+}
+
+func TestTimerStopTwice(t *testing.T) {
+	s := &fakeSender{}
+	xs := New(s)
+	tm := xs.StartTimer("metric")
+	tm.Stop()
+	s.last = cmd{}
+	assert.Equal(t, time.Duration(0), tm.Stop())
+	assert.Equal(t, time.Duration(0), tm.Elapsed())
+	assert.Equal(t, cmd{}, s.last)
+	assert.Equal(t, time.Duration(0), Timer{}.Stop())
+}
+
+func TestTimerStaleStop(t *testing.T) {
+	now = fakeNow()
+	defer func() { now = time.Now }()
+
+	// The pool hands the state of the stopped timer over to the next one
+	st := &timer{}
+	defer func(pool *sync.Pool) {
+		timerPool = pool
+	}(timerPool)
+	timerPool = &sync.Pool{New: func() interface{} { return st }}
+
+	s := &fakeSender{}
+	xs := New(s)
+	tm1 := xs.StartTimer("metric1")
+	tm1.Stop()
+	tm2 := xs.StartTimer("metric2")
+	assert.Equal(t, st, tm2.t)
+	s.last = cmd{}
+	assert.Equal(t, time.Duration(0), tm1.Stop())
+	assert.Equal(t, cmd{}, s.last)
+	assert.NotEqual(t, time.Duration(0), tm2.Stop())
+	assert.Equal(t, "metric2", s.last.stat)
+}
+
+func TestTimerAllocs(t *testing.T) {
+	xs := New(&countingSender{})
+	xs.StartTimer("metric", "tag").Stop()
+	allocs := testing.AllocsPerRun(100, func() {
+		xs.StartTimer("metric", "tag").StopWithTags("tag2")
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func BenchmarkTimer(b *testing.B) {
+	xs := New(&countingSender{})
+	xs.StartTimer("metric", "tag").Stop()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		xs.StartTimer("metric", "tag").Stop()
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		xs.StartTimer("metric", "tag").Stop()
+	}); allocs != 0 {
+		b.Fatalf("%v allocs per timer", allocs)
+	}
+}
@@ -0,0 +1,149 @@
+// Package udp implements a self-healing UDP writer for the line-protocol
+// senders of github.com/rs/xstats (statsd, dogstatsd and telegraf).
+//
+// A net.Conn returned by net.Dial stays pinned to the address resolved when it
+// was created. The Writer periodically resolves the agent's host name again
+// and redials when the address changes or when writes keep failing, so
+// metrics keep flowing after the agent is rescheduled.
+package udp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultResolveInterval is the default interval between two resolutions
+	// of the agent's address.
+	DefaultResolveInterval = 30 * time.Second
+	// DefaultMaxWriteErrors is the default number of write errors on a
+	// connection after which the writer redials.
+	DefaultMaxWriteErrors = 3
+)
+
+// ErrClosed is returned by writes on a closed Writer.
+var ErrClosed = errors.New("udp: write on closed writer")
+
+var (
+	resolveUDPAddr = net.ResolveUDPAddr
+	now            = time.Now
+)
+
+// Writer is an io.Writer sending each write as a UDP packet to an address
+// resolved periodically.
+type Writer struct {
+	addr            string
+	resolveInterval time.Duration
+	maxWriteErrors  int
+
+	mu          sync.Mutex
+	conn        *net.UDPConn
+	raddr       *net.UDPAddr
+	resolvedAt  time.Time
+	writeErrors int
+	closed      bool
+}
+
+// Option configures a Writer.
+type Option func(*Writer)
+
+// ResolveInterval sets the interval between two resolutions of the address.
+// A zero or negative interval disables periodic resolution.
+func ResolveInterval(d time.Duration) Option {
+	return func(w *Writer) {
+		w.resolveInterval = d
+	}
+}
+
+// MaxWriteErrors sets the number of write errors on a connection after which
+// the writer resolves the address again and redials.
+func MaxWriteErrors(n int) Option {
+	return func(w *Writer) {
+		w.maxWriteErrors = n
+	}
+}
+
+// Dial creates a Writer sending packets to addr, a host:port address.
+func Dial(addr string, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		addr:            addr,
+		resolveInterval: DefaultResolveInterval,
+		maxWriteErrors:  DefaultMaxWriteErrors,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if err := w.redial(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write implements io.Writer interface
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.conn == nil || (w.resolveInterval > 0 && now().Sub(w.resolvedAt) >= w.resolveInterval) {
+		// On failure keep using the current connection if any until the next
+		// resolution.
+		if err := w.redial(); err != nil && w.conn == nil {
+			return 0, err
+		}
+	}
+	n, err := w.conn.Write(p)
+	if err != nil {
+		// Errors like connection refused are reported on every other write
+		// on UDP sockets, so errors are counted since the last dial rather
+		// than consecutively.
+		w.writeErrors++
+		if w.writeErrors >= w.maxWriteErrors {
+			// Force a new resolution and dial on next write.
+			w.conn.Close()
+			w.conn = nil
+			w.raddr = nil
+		}
+	}
+	return n, err
+}
+
+// redial resolves the address and dials it if it changed since the last
+// resolution.
+func (w *Writer) redial() error {
+	w.resolvedAt = now()
+	raddr, err := resolveUDPAddr("udp", w.addr)
+	if err != nil {
+		return err
+	}
+	if w.conn != nil && w.raddr != nil && raddr.IP.Equal(w.raddr.IP) && raddr.Port == w.raddr.Port {
+		return nil
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return err
+	}
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	w.conn = conn
+	w.raddr = raddr
+	w.writeErrors = 0
+	return nil
+}
+
+// Close implements io.Closer interface - later writes fail with ErrClosed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
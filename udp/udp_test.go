@@ -0,0 +1,161 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T) *net.UDPConn {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func read(t *testing.T, l *net.UDPConn) string {
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 1024)
+	n, err := l.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b[:n])
+}
+
+// fakeResolver resolves to the address of the current listener.
+type fakeResolver struct {
+	addr  *net.UDPAddr
+	err   error
+	calls int
+}
+
+func (r *fakeResolver) resolve(network, addr string) (*net.UDPAddr, error) {
+	r.calls++
+	return r.addr, r.err
+}
+
+func fakeClock() (func() time.Time, func(time.Duration)) {
+	t := time.Now()
+	return func() time.Time { return t }, func(d time.Duration) { t = t.Add(d) }
+}
+
+func TestReresolve(t *testing.T) {
+	var advance func(time.Duration)
+	now, advance = fakeClock()
+	r := &fakeResolver{}
+	resolveUDPAddr = r.resolve
+	defer func() { now, resolveUDPAddr = time.Now, net.ResolveUDPAddr }()
+
+	l1, l2 := listen(t), listen(t)
+	defer l1.Close()
+	defer l2.Close()
+
+	r.addr = l1.LocalAddr().(*net.UDPAddr)
+	w, err := Dial("agent:8125", ResolveInterval(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("a"))
+	assert.Equal(t, "a", read(t, l1))
+
+	// The agent moves, the writer keeps the old address until the interval
+	// is elapsed.
+	r.addr = l2.LocalAddr().(*net.UDPAddr)
+	w.Write([]byte("b"))
+	assert.Equal(t, "b", read(t, l1))
+	assert.Equal(t, 1, r.calls)
+
+	advance(time.Minute)
+	w.Write([]byte("c"))
+	assert.Equal(t, "c", read(t, l2))
+	assert.Equal(t, 2, r.calls)
+}
+
+func TestResolveErrorKeepsConn(t *testing.T) {
+	var advance func(time.Duration)
+	now, advance = fakeClock()
+	r := &fakeResolver{}
+	resolveUDPAddr = r.resolve
+	defer func() { now, resolveUDPAddr = time.Now, net.ResolveUDPAddr }()
+
+	l := listen(t)
+	defer l.Close()
+
+	r.addr = l.LocalAddr().(*net.UDPAddr)
+	w, err := Dial("agent:8125", ResolveInterval(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	r.err = errors.New("no such host")
+	advance(time.Minute)
+	_, err = w.Write([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a", read(t, l))
+}
+
+func TestRedialAfterWriteErrors(t *testing.T) {
+	r := &fakeResolver{}
+	resolveUDPAddr = r.resolve
+	defer func() { resolveUDPAddr = net.ResolveUDPAddr }()
+
+	l, dead := listen(t), listen(t)
+	defer l.Close()
+
+	// Write to a closed port to get connection refused errors
+	r.addr = dead.LocalAddr().(*net.UDPAddr)
+	dead.Close()
+
+	w, err := Dial("agent:8125", ResolveInterval(0), MaxWriteErrors(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	r.addr = l.LocalAddr().(*net.UDPAddr)
+
+	// Connection refused errors are reported asynchronously by the kernel
+	for i := 0; i < 10 && w.conn != nil; i++ {
+		w.Write([]byte("lost"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, w.conn)
+	assert.Equal(t, 1, r.calls)
+	w.Write([]byte("a"))
+	assert.Equal(t, 2, r.calls)
+	assert.Equal(t, "a", read(t, l))
+}
+
+func TestDialError(t *testing.T) {
+	resolveUDPAddr = func(string, string) (*net.UDPAddr, error) {
+		return nil, errors.New("no such host")
+	}
+	defer func() { resolveUDPAddr = net.ResolveUDPAddr }()
+
+	_, err := Dial("agent:8125")
+	assert.EqualError(t, err, "no such host")
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	l := listen(t)
+	defer l.Close()
+
+	w, err := Dial(l.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Close())
+	n, err := w.Write([]byte("a"))
+	assert.Equal(t, 0, n)
+	assert.Equal(t, ErrClosed, err)
+	assert.Nil(t, w.conn)
+	assert.NoError(t, w.Close())
+}
@@ -19,6 +19,8 @@ package xstats // import "github.com/rs/xstats"
 
 import (
 	"io"
+	"math/rand"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -34,20 +36,146 @@ var (
 	// handler. However, using this option puts a greater pressure on GC and changes
 	// the memory usage patterns of the library. Use only if there is a requirement
 	// for persistent stater references.
+	//
+	// Deprecated: DisablePooling is only read when an XStater or a Factory is
+	// created without an explicit pooling setting. Use a Factory with the
+	// WithPooling option instead.
 	DisablePooling = false
+
+	// debugPooling is set in debug builds, see OnUseAfterClose.
+	debugPooling = debugBuild
 )
 
 // XStater is a wrapper around a Sender to inject env tags within all observations.
+//
+// The XStater returned by New, NewPrefix and NewScoping is safe for
+// concurrent use: tags can be changed while observations are sent from
+// other goroutines. Its copies and scopes have their own tags.
 type XStater interface {
 	Sender
 
 	// AddTag adds a tag to the request client, this tag will be sent with all
-	// subsequent stats queries.
+	// subsequent stats queries. A tag replaces the tag previously added with
+	// the same key, the part before the first colon. Tags given to an
+	// observation replace the tags of the client with the same key.
 	AddTags(tags ...string)
 
+	// SetTag adds the "key:value" tag, replacing the tag with the same key.
+	SetTag(key, value string)
+
+	// RemoveTags removes the tags with the given keys.
+	RemoveTags(keys ...string)
+
 	// GetTags returns the tags associated with the XStater, all the tags that
-	// will be sent along with all the stats queries.
+	// will be sent along with all the stats queries. The returned slice must
+	// not be modified.
 	GetTags() []string
+
+	// AddTagPairs is like AddTags with structured tags.
+	AddTagPairs(tags ...Tag)
+
+	// GaugeT is like Gauge with structured tags.
+	GaugeT(stat string, value float64, tags ...Tag)
+
+	// CountT is like Count with structured tags.
+	CountT(stat string, count float64, tags ...Tag)
+
+	// HistogramT is like Histogram with structured tags.
+	HistogramT(stat string, value float64, tags ...Tag)
+
+	// TimingT is like Timing with structured tags.
+	TimingT(stat string, value time.Duration, tags ...Tag)
+
+	// CountSampled is like Count but only sends the observation with a
+	// probability of rate, between 0 and 1.
+	CountSampled(stat string, count float64, rate float64, tags ...string)
+
+	// HistogramSampled is like Histogram but only sends the observation with
+	// a probability of rate, between 0 and 1.
+	HistogramSampled(stat string, value float64, rate float64, tags ...string)
+
+	// TimingSampled is like Timing but only sends the observation with a
+	// probability of rate, between 0 and 1.
+	TimingSampled(stat string, value time.Duration, rate float64, tags ...string)
+
+	// Set counts the number of unique values observed for a stat. It is
+	// ignored if the sender does not implement SetSender.
+	Set(stat string, value string, tags ...string)
+
+	// GaugeDelta adds delta, which may be negative, to the value of a gauge.
+	// It is ignored if the sender does not implement GaugeDeltaSender.
+	GaugeDelta(stat string, delta float64, tags ...string)
+
+	// Distribution tracks the global distribution of a value across hosts.
+	// It is sent as an histogram if the sender does not implement
+	// DistributionSender.
+	Distribution(stat string, value float64, tags ...string)
+
+	// Event sends an event with the XStater tags. It is ignored if the
+	// sender does not implement EventSender.
+	Event(e Event)
+
+	// ServiceCheck sends a service check with the XStater tags, its name is
+	// prefixed like metrics. It is ignored if the sender does not implement
+	// EventSender.
+	ServiceCheck(sc ServiceCheck)
+
+	// StartTimer returns a timer sending the duration of an operation as a
+	// timing of stat when stopped.
+	StartTimer(stat string, tags ...string) Timer
+
+	// TimeFunc calls f and sends its duration as a timing of stat.
+	TimeFunc(stat string, f func(), tags ...string)
+
+	// With returns a copy of the XStater with the options applied in order,
+	// like a Scope with added tags.
+	With(opts ...Option) XStater
+}
+
+// Option configures the XStater returned by With.
+type Option func(*xstats)
+
+// WithScope appends scopes to the prefix, like Scope.
+func WithScope(scope string, scopes ...string) Option {
+	return func(xs *xstats) {
+		xs.prefix += scope + xs.delimiter
+		for _, s := range scopes {
+			xs.prefix += s + xs.delimiter
+		}
+	}
+}
+
+// WithTags adds tags, like AddTags.
+func WithTags(tags ...string) Option {
+	return func(xs *xstats) {
+		xs.AddTags(tags...)
+	}
+}
+
+// WithTagPairs adds structured tags, like AddTagPairs.
+func WithTagPairs(tags ...Tag) Option {
+	return func(xs *xstats) {
+		xs.AddTagPairs(tags...)
+	}
+}
+
+// WithDelimiter changes the delimiter of the following scopes. The delimiter
+// ending the current prefix is replaced.
+func WithDelimiter(delimiter string) Option {
+	return func(xs *xstats) {
+		if xs.prefix != "" {
+			xs.prefix = strings.TrimSuffix(xs.prefix, xs.delimiter) + delimiter
+		}
+		xs.delimiter = delimiter
+	}
+}
+
+// WithSender sends the observations to s instead of the sender of the
+// XStater.
+func WithSender(s Sender) Option {
+	return func(xs *xstats) {
+		xs.s = s
+	}
 }
 
 // Copier is an interface to an XStater that supports coping
@@ -60,9 +188,12 @@ type Scoper interface {
 	Scope(scope string, scopes ...string) XStater
 }
 
+// random returns a number in [0.0,1.0) used to sample observations.
+var random = rand.Float64
+
 var xstatsPool = &sync.Pool{
 	New: func() interface{} {
-		return &xstats{}
+		return &state{}
 	},
 }
 
@@ -80,11 +211,18 @@ func NewPrefix(s Sender, prefix string) XStater {
 // NewScoping returns a new xstats client with the provided backend sender.
 // The delimiter is used to delimit scopes. Initial scopes can be provided.
 func NewScoping(s Sender, delimiter string, scopes ...string) XStater {
+	return newScoping(s, !DisablePooling, delimiter, scopes...)
+}
+
+// newScoping is like NewScoping, taking the instance from the pool if pooling
+// is true.
+func newScoping(s Sender, pooling bool, delimiter string, scopes ...string) *xstats {
 	var xs *xstats
-	if DisablePooling {
-		xs = &xstats{}
+	if pooling {
+		st := xstatsPool.Get().(*state)
+		xs = &xstats{state: st, gen: st.generation}
 	} else {
-		xs = xstatsPool.Get().(*xstats)
+		xs = &xstats{state: &state{}, detached: true}
 	}
 	xs.s = s
 	if len(scopes) > 0 {
@@ -122,97 +260,462 @@ func Close(xs XStater) error {
 	return nil
 }
 
+// xstats is an XStater, a handle to a state. Pooled states are reused once
+// closed, the handles of a previous generation of their state see them as
+// closed.
 type xstats struct {
-	s Sender
+	*state
+	// gen is the generation of the state the handle was created for.
+	gen uint64
+	// detached instances are not pooled, they are never returned to the pool
+	// and neither are their copies and scopes.
+	detached bool
+}
+
+// state holds the sender, prefix and tags of an XStater.
+type state struct {
+	// mu protects the fields of the state. Tags and pairs are replaced but
+	// never modified in place, so they can be used after releasing the lock
+	// and be shared with copies.
+	mu sync.RWMutex
+	// generation is incremented when the state is closed.
+	generation uint64
+	// closeStack is the stack of the goroutine which closed the state, only
+	// captured in debug builds.
+	closeStack []byte
+	s          Sender
 	// tags are appended to the tags provided to commands
 	tags []string
+	// pairs holds the same tags as tags in the structured form
+	pairs []Tag
 	// prefix is prepended to all metric
 	prefix string
 	// delimiter is used to delimit scopes
 	delimiter string
 }
 
+// view holds the fields of an XStater used to send an observation, read at
+// once so they are consistent.
+type view struct {
+	s         Sender
+	tags      []string
+	pairs     []Tag
+	prefix    string
+	delimiter string
+}
+
+// load returns the view of xs, false if xs is closed.
+func (xs *xstats) load() (view, bool) {
+	xs.mu.RLock()
+	defer xs.mu.RUnlock()
+	if xs.state.generation != xs.gen {
+		return view{}, false
+	}
+	return view{xs.s, xs.tags, xs.pairs, xs.prefix, xs.delimiter}, true
+}
+
+// observe returns the view used to send an observation of stat. It returns
+// false if the observation must be discarded because xs has no sender or is
+// closed, reporting it to OnUseAfterClose.
+func (xs *xstats) observe(stat string) (view, bool) {
+	v, ok := xs.load()
+	if !ok {
+		xs.released(stat)
+		return v, false
+	}
+	return v, v.s != nil
+}
+
 // Copy implements the Copier interface
 func (xs *xstats) Copy() XStater {
-	xs2 := NewScoping(xs.s, xs.delimiter, xs.prefix).(*xstats)
-	xs2.tags = xs.tags
+	return xs.copy(!xs.detached)
+}
+
+// copy returns a copy of xs, taken from the pool if pooling is true.
+func (xs *xstats) copy(pooling bool) *xstats {
+	v, _ := xs.load()
+	xs2 := newScoping(v.s, pooling, v.delimiter)
+	// The prefix already ends with the delimiter
+	xs2.prefix = v.prefix
+	xs2.tags, xs2.pairs = v.tags, v.pairs
+	return xs2
+}
+
+// With implements XStater interface
+func (xs *xstats) With(opts ...Option) XStater {
+	xs2 := xs.copy(!xs.detached)
+	for _, opt := range opts {
+		opt(xs2)
+	}
 	return xs2
 }
 
 // Scope implements Scoper interface
 func (xs *xstats) Scope(scope string, scopes ...string) XStater {
+	v, _ := xs.load()
 	var scs []string
-	if xs.prefix == "" {
+	if v.prefix == "" {
 		scs = make([]string, 0, 1+len(scopes))
 	} else {
 		scs = make([]string, 0, 2+len(scopes))
-		scs = append(scs, strings.TrimRight(xs.prefix, xs.delimiter))
+		scs = append(scs, strings.TrimRight(v.prefix, v.delimiter))
 	}
 	scs = append(scs, scope)
 	scs = append(scs, scopes...)
-	xs2 := NewScoping(xs.s, xs.delimiter, scs...).(*xstats)
-	xs2.tags = xs.tags
+	xs2 := newScoping(v.s, !xs.detached, v.delimiter, scs...)
+	xs2.tags, xs2.pairs = v.tags, v.pairs
 	return xs2
 }
 
-// Close returns the xstats to the sync.Pool
+// Close returns the xstats to the sync.Pool. Observations sent after close are
+// discarded and reported to OnUseAfterClose, also once the state is reused.
 func (xs *xstats) Close() error {
-	if !DisablePooling {
-		xs.s = nil
-		xs.tags = nil
-		xs.prefix = ""
-		xs.delimiter = ""
-		xstatsPool.Put(xs)
+	if xs.detached {
+		return nil
 	}
+	xs.mu.Lock()
+	if xs.state.generation != xs.gen {
+		// Already closed
+		xs.mu.Unlock()
+		return nil
+	}
+	xs.state.generation++
+	if debugPooling {
+		// Keep the instance out of the pool so the stack can be reported
+		xs.closeStack = debug.Stack()
+		xs.mu.Unlock()
+		return nil
+	}
+	xs.s = nil
+	xs.tags = nil
+	xs.pairs = nil
+	xs.prefix = ""
+	xs.delimiter = ""
+	xs.mu.Unlock()
+	xstatsPool.Put(xs.state)
 	return nil
 }
 
 // AddTag implements XStater interface
 func (xs *xstats) AddTags(tags ...string) {
-	if xs.tags == nil {
-		xs.tags = tags
-	} else {
-		xs.tags = append(xs.tags, tags...)
+	xs.addTags(tags, parseTags(tags))
+}
+
+// AddTagPairs implements XStater interface
+func (xs *xstats) AddTagPairs(tags ...Tag) {
+	xs.addTags(TagStrings(tags), tags)
+}
+
+// SetTag implements XStater interface
+func (xs *xstats) SetTag(key, value string) {
+	t := Tag{Key: key, Value: value}
+	xs.addTags([]string{t.String()}, []Tag{t})
+}
+
+// RemoveTags implements XStater interface
+func (xs *xstats) RemoveTags(keys ...string) {
+	xs.mu.Lock()
+	defer xs.mu.Unlock()
+	if xs.state.generation != xs.gen {
+		return
+	}
+	tags := make([]string, 0, len(xs.tags))
+	pairs := make([]Tag, 0, len(xs.pairs))
+	for i, p := range xs.pairs {
+		if !containsKey(keys, p.Key) {
+			tags = append(tags, xs.tags[i])
+			pairs = append(pairs, p)
+		}
+	}
+	xs.tags, xs.pairs = tags, pairs
+}
+
+// addTags adds tags given in both forms, replacing the tags of xs with the
+// same key. The tags of xs are copied as they may be shared with copies of
+// xs.
+func (xs *xstats) addTags(tags []string, pairs []Tag) {
+	xs.mu.Lock()
+	defer xs.mu.Unlock()
+	if xs.state.generation != xs.gen {
+		return
+	}
+	newTags := make([]string, len(xs.tags), len(xs.tags)+len(tags))
+	copy(newTags, xs.tags)
+	newPairs := make([]Tag, len(xs.pairs), len(xs.pairs)+len(pairs))
+	copy(newPairs, xs.pairs)
+	for i, p := range pairs {
+		if j := indexKey(newPairs, p.Key); j >= 0 {
+			newTags[j], newPairs[j] = tags[i], p
+			continue
+		}
+		newTags = append(newTags, tags[i])
+		newPairs = append(newPairs, p)
+	}
+	xs.tags, xs.pairs = newTags, newPairs
+}
+
+// indexKey returns the index of the tag with the given key, -1 if none.
+func indexKey(tags []Tag, key string) int {
+	for i, t := range tags {
+		if t.Key == key {
+			return i
+		}
 	}
+	return -1
+}
+
+// containsKey returns true if keys contains key.
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
 }
 
 // AddTag implements XStater interface
 func (xs *xstats) GetTags() []string {
-	return xs.tags
+	v, _ := xs.load()
+	return v.tags
+}
+
+// withTags returns the tags of an observation followed by the tags of the
+// XStater with a different key. It only allocates if both are set.
+func (v view) withTags(tags []string) []string {
+	xsTags, xsPairs := v.tags, v.pairs
+	if len(xsTags) == 0 {
+		return tags
+	}
+	if len(tags) == 0 {
+		// Limit the capacity so a sender appending to the tags can't
+		// overwrite ours
+		return xsTags[:len(xsTags):len(xsTags)]
+	}
+	merged := make([]string, len(tags), len(tags)+len(xsTags))
+	copy(merged, tags)
+	for i, p := range xsPairs {
+		if !hasKey(tags, p.Key) {
+			merged = append(merged, xsTags[i])
+		}
+	}
+	return merged
+}
+
+// hasKey returns true if one of the tags in the string form has the key.
+func hasKey(tags []string, key string) bool {
+	for _, t := range tags {
+		if ParseTag(t).Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// withTagPairs is like withTags for structured tags.
+func (v view) withTagPairs(tags []Tag) []Tag {
+	xsPairs := v.pairs
+	if len(xsPairs) == 0 {
+		return tags
+	}
+	if len(tags) == 0 {
+		return xsPairs[:len(xsPairs):len(xsPairs)]
+	}
+	merged := make([]Tag, len(tags), len(tags)+len(xsPairs))
+	copy(merged, tags)
+	for _, p := range xsPairs {
+		if indexKey(tags, p.Key) < 0 {
+			merged = append(merged, p)
+		}
+	}
+	return merged
 }
 
 // Gauge implements XStater interface
 func (xs *xstats) Gauge(stat string, value float64, tags ...string) {
-	if xs.s == nil {
+	v, ok := xs.observe(stat)
+	if !ok {
 		return
 	}
-	tags = append(tags, xs.tags...)
-	xs.s.Gauge(xs.prefix+stat, value, tags...)
+	tags = v.withTags(tags)
+	v.s.Gauge(v.prefix+stat, value, tags...)
 }
 
 // Count implements XStater interface
 func (xs *xstats) Count(stat string, count float64, tags ...string) {
-	if xs.s == nil {
+	v, ok := xs.observe(stat)
+	if !ok {
 		return
 	}
-	tags = append(tags, xs.tags...)
-	xs.s.Count(xs.prefix+stat, count, tags...)
+	tags = v.withTags(tags)
+	v.s.Count(v.prefix+stat, count, tags...)
 }
 
 // Histogram implements XStater interface
 func (xs *xstats) Histogram(stat string, value float64, tags ...string) {
-	if xs.s == nil {
+	v, ok := xs.observe(stat)
+	if !ok {
 		return
 	}
-	tags = append(tags, xs.tags...)
-	xs.s.Histogram(xs.prefix+stat, value, tags...)
+	tags = v.withTags(tags)
+	v.s.Histogram(v.prefix+stat, value, tags...)
 }
 
 // Timing implements XStater interface
 func (xs *xstats) Timing(stat string, duration time.Duration, tags ...string) {
-	if xs.s == nil {
+	v, ok := xs.observe(stat)
+	if !ok {
+		return
+	}
+	tags = v.withTags(tags)
+	v.s.Timing(v.prefix+stat, duration, tags...)
+}
+
+// GaugeT implements XStater interface
+func (xs *xstats) GaugeT(stat string, value float64, tags ...Tag) {
+	v, ok := xs.observe(stat)
+	if !ok {
+		return
+	}
+	gaugeT(v.s, v.prefix+stat, value, v.withTagPairs(tags))
+}
+
+// CountT implements XStater interface
+func (xs *xstats) CountT(stat string, count float64, tags ...Tag) {
+	v, ok := xs.observe(stat)
+	if !ok {
+		return
+	}
+	countT(v.s, v.prefix+stat, count, v.withTagPairs(tags))
+}
+
+// HistogramT implements XStater interface
+func (xs *xstats) HistogramT(stat string, value float64, tags ...Tag) {
+	v, ok := xs.observe(stat)
+	if !ok {
+		return
+	}
+	histogramT(v.s, v.prefix+stat, value, v.withTagPairs(tags))
+}
+
+// TimingT implements XStater interface
+func (xs *xstats) TimingT(stat string, duration time.Duration, tags ...Tag) {
+	v, ok := xs.observe(stat)
+	if !ok {
+		return
+	}
+	timingT(v.s, v.prefix+stat, duration, v.withTagPairs(tags))
+}
+
+// sampled returns true if an observation with the given sample rate must be
+// sent.
+func sampled(rate float64) bool {
+	return rate >= 1 || (rate > 0 && random() < rate)
+}
+
+// CountSampled implements XStater interface
+func (xs *xstats) CountSampled(stat string, count float64, rate float64, tags ...string) {
+	v, ok := xs.observe(stat)
+	if !ok || !sampled(rate) {
+		return
+	}
+	tags = v.withTags(tags)
+	if rate >= 1 {
+		v.s.Count(v.prefix+stat, count, tags...)
+		return
+	}
+	countSampled(v.s, v.prefix+stat, count, rate, tags)
+}
+
+// HistogramSampled implements XStater interface
+func (xs *xstats) HistogramSampled(stat string, value float64, rate float64, tags ...string) {
+	v, ok := xs.observe(stat)
+	if !ok || !sampled(rate) {
+		return
+	}
+	tags = v.withTags(tags)
+	if rate >= 1 {
+		v.s.Histogram(v.prefix+stat, value, tags...)
+		return
+	}
+	histogramSampled(v.s, v.prefix+stat, value, rate, tags)
+}
+
+// TimingSampled implements XStater interface
+func (xs *xstats) TimingSampled(stat string, duration time.Duration, rate float64, tags ...string) {
+	v, ok := xs.observe(stat)
+	if !ok || !sampled(rate) {
+		return
+	}
+	tags = v.withTags(tags)
+	if rate >= 1 {
+		v.s.Timing(v.prefix+stat, duration, tags...)
+		return
+	}
+	timingSampled(v.s, v.prefix+stat, duration, rate, tags)
+}
+
+// StartTimer implements XStater interface
+func (xs *xstats) StartTimer(stat string, tags ...string) Timer {
+	return startTimer(xs, stat, tags)
+}
+
+// TimeFunc implements XStater interface
+func (xs *xstats) TimeFunc(stat string, f func(), tags ...string) {
+	timeFunc(xs, stat, f, tags)
+}
+
+// Set implements XStater interface
+func (xs *xstats) Set(stat string, value string, tags ...string) {
+	v, ok := xs.observe(stat)
+	ss, isSender := v.s.(SetSender)
+	if !ok || !isSender {
+		return
+	}
+	tags = v.withTags(tags)
+	ss.Set(v.prefix+stat, value, tags...)
+}
+
+// GaugeDelta implements XStater interface
+func (xs *xstats) GaugeDelta(stat string, delta float64, tags ...string) {
+	v, ok := xs.observe(stat)
+	gs, isSender := v.s.(GaugeDeltaSender)
+	if !ok || !isSender {
+		return
+	}
+	tags = v.withTags(tags)
+	gs.GaugeDelta(v.prefix+stat, delta, tags...)
+}
+
+// Distribution implements XStater interface
+func (xs *xstats) Distribution(stat string, value float64, tags ...string) {
+	v, ok := xs.observe(stat)
+	if !ok {
+		return
+	}
+	tags = v.withTags(tags)
+	distribution(v.s, v.prefix+stat, value, tags)
+}
+
+// Event implements XStater interface
+func (xs *xstats) Event(e Event) {
+	v, ok := xs.observe(e.Title)
+	es, isSender := v.s.(EventSender)
+	if !ok || !isSender {
+		return
+	}
+	e.Tags = v.withTags(e.Tags)
+	es.Event(e)
+}
+
+// ServiceCheck implements XStater interface
+func (xs *xstats) ServiceCheck(sc ServiceCheck) {
+	v, ok := xs.observe(sc.Name)
+	es, isSender := v.s.(EventSender)
+	if !ok || !isSender {
 		return
 	}
-	tags = append(tags, xs.tags...)
-	xs.s.Timing(xs.prefix+stat, duration, tags...)
+	sc.Name = v.prefix + sc.Name
+	sc.Tags = v.withTags(sc.Tags)
+	es.ServiceCheck(sc)
 }
@@ -1,7 +1,10 @@
 package xstats
 
 import (
+	"math/rand"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -41,6 +44,91 @@ func (s *fakeSender) Timing(stat string, duration time.Duration, tags ...string)
 	s.last = cmd{"Timing", stat, duration.Seconds(), tags}
 }
 
+type fakeSampledSender struct {
+	fakeSender
+	rate float64
+}
+
+func (s *fakeSampledSender) CountSampled(stat string, count float64, rate float64, tags ...string) {
+	s.last = cmd{"CountSampled", stat, count, tags}
+	s.rate = rate
+}
+
+func (s *fakeSampledSender) HistogramSampled(stat string, value float64, rate float64, tags ...string) {
+	s.last = cmd{"HistogramSampled", stat, value, tags}
+	s.rate = rate
+}
+
+func (s *fakeSampledSender) TimingSampled(stat string, duration time.Duration, rate float64, tags ...string) {
+	s.last = cmd{"TimingSampled", stat, duration.Seconds(), tags}
+	s.rate = rate
+}
+
+type fakeSetSender struct {
+	fakeSender
+	value string
+}
+
+func (s *fakeSetSender) Set(stat string, value string, tags ...string) {
+	s.last = cmd{"Set", stat, 0, tags}
+	s.value = value
+}
+
+type fakeGaugeDeltaSender struct {
+	fakeSender
+}
+
+func (s *fakeGaugeDeltaSender) GaugeDelta(stat string, delta float64, tags ...string) {
+	s.last = cmd{"GaugeDelta", stat, delta, tags}
+}
+
+type fakeDistributionSender struct {
+	fakeSender
+}
+
+func (s *fakeDistributionSender) Distribution(stat string, value float64, tags ...string) {
+	s.last = cmd{"Distribution", stat, value, tags}
+}
+
+type fakeEventSender struct {
+	fakeSender
+	event        Event
+	serviceCheck ServiceCheck
+}
+
+func (s *fakeEventSender) Event(e Event) {
+	s.event = e
+}
+
+func (s *fakeEventSender) ServiceCheck(sc ServiceCheck) {
+	s.serviceCheck = sc
+}
+
+type fakeTagSender struct {
+	fakeSender
+	pairs []Tag
+}
+
+func (s *fakeTagSender) GaugeT(stat string, value float64, tags ...Tag) {
+	s.last = cmd{"GaugeT", stat, value, nil}
+	s.pairs = tags
+}
+
+func (s *fakeTagSender) CountT(stat string, count float64, tags ...Tag) {
+	s.last = cmd{"CountT", stat, count, nil}
+	s.pairs = tags
+}
+
+func (s *fakeTagSender) HistogramT(stat string, value float64, tags ...Tag) {
+	s.last = cmd{"HistogramT", stat, value, nil}
+	s.pairs = tags
+}
+
+func (s *fakeTagSender) TimingT(stat string, duration time.Duration, tags ...Tag) {
+	s.last = cmd{"TimingT", stat, duration.Seconds(), nil}
+	s.pairs = tags
+}
+
 func (s *fakeSendCloser) Close() error {
 	s.fakeSender.last = cmd{name: "Close"}
 	return s.err
@@ -146,15 +234,128 @@ func TestScope(t *testing.T) {
 	assert.Equal(t, nop, Scope(nil, "prefix"))
 }
 
+func TestWith(t *testing.T) {
+	s := &fakeSender{}
+	xs := NewScoping(s, ".", "prefix").(*xstats)
+	xs.AddTags("foo")
+
+	xs2 := xs.With(WithScope("infix", "suffix"), WithTags("bar"), WithTagPairs(Tag{"baz", "1"})).(*xstats)
+	assert.Equal(t, s, xs2.s)
+	assert.Equal(t, "prefix.infix.suffix.", xs2.prefix)
+	assert.Equal(t, []string{"foo", "bar", "baz:1"}, xs2.tags)
+	assert.Equal(t, []string{"foo"}, xs.tags)
+	assert.Equal(t, "prefix.", xs.prefix)
+
+	s2 := &fakeSender{}
+	xs3 := xs2.With(WithDelimiter("/"), WithScope("sub"), WithSender(s2))
+	xs3.Count("metric", 1)
+	assert.Equal(t, cmd{"Count", "prefix.infix.suffix/sub/metric", 1, []string{"foo", "bar", "baz:1"}}, s2.last)
+	assert.Equal(t, cmd{}, s.last)
+
+	xs4 := xs.With().(*xstats)
+	assert.Equal(t, "prefix.", xs4.prefix)
+	assert.Equal(t, ".", xs4.delimiter)
+	assert.Equal(t, "prefix.", Copy(xs).(*xstats).prefix)
+}
+
 func TestAddTag(t *testing.T) {
-	xs := &xstats{s: &fakeSender{}}
+	xs := &xstats{state: &state{s: &fakeSender{}}}
 	xs.AddTags("foo")
 	assert.Equal(t, []string{"foo"}, xs.tags)
 }
 
+func TestAddTagOverride(t *testing.T) {
+	xs := &xstats{state: &state{s: &fakeSender{}}}
+	xs.AddTags("route:a", "env:prod", "foo")
+	xs.AddTags("route:b", "foo")
+	assert.Equal(t, []string{"route:b", "env:prod", "foo"}, xs.GetTags())
+	xs.AddTagPairs(Tag{"env", "dev"})
+	assert.Equal(t, []string{"route:b", "env:dev", "foo"}, xs.GetTags())
+	assert.Equal(t, []Tag{{"route", "b"}, {"env", "dev"}, {Key: "foo"}}, xs.pairs)
+}
+
+func TestSetTag(t *testing.T) {
+	xs := &xstats{state: &state{s: &fakeSender{}}}
+	xs.SetTag("route", "a")
+	xs.SetTag("env", "prod")
+	xs.SetTag("route", "b")
+	assert.Equal(t, []string{"route:b", "env:prod"}, xs.GetTags())
+}
+
+func TestRemoveTags(t *testing.T) {
+	xs := &xstats{state: &state{s: &fakeSender{}}}
+	xs.AddTags("route:a", "env:prod", "foo")
+	xs.RemoveTags("route", "foo", "bar")
+	assert.Equal(t, []string{"env:prod"}, xs.GetTags())
+	assert.Equal(t, []Tag{{"env", "prod"}}, xs.pairs)
+}
+
+func TestTagOverrideCopy(t *testing.T) {
+	xs := NewPrefix(&fakeSender{}, "p.")
+	xs.AddTags("route:a")
+	xs2 := Copy(xs)
+	xs.AddTags("route:b")
+	xs2.RemoveTags("route")
+	assert.Equal(t, []string{"route:b"}, xs.GetTags())
+	assert.Empty(t, xs2.GetTags())
+}
+
+func TestCallTagsOverride(t *testing.T) {
+	s := &fakeSender{}
+	xs := &xstats{state: &state{s: s}}
+	xs.AddTags("route:a", "env:prod")
+	xs.Count("bar", 1, "route:b", "foo")
+	assert.Equal(t, cmd{"Count", "bar", 1, []string{"route:b", "foo", "env:prod"}}, s.last)
+
+	ts := &fakeTagSender{}
+	xs.s = ts
+	xs.CountT("bar", 1, Tag{"env", "dev"})
+	assert.Equal(t, []Tag{{"env", "dev"}, {"route", "a"}}, ts.pairs)
+}
+
+func TestAddTagPairs(t *testing.T) {
+	xs := &xstats{state: &state{s: &fakeSender{}}}
+	xs.AddTags("foo:bar")
+	xs.AddTagPairs(Tag{"baz", "1"})
+	assert.Equal(t, []string{"foo:bar", "baz:1"}, xs.GetTags())
+	assert.Equal(t, []Tag{{"foo", "bar"}, {"baz", "1"}}, xs.pairs)
+}
+
+func TestTagPairs(t *testing.T) {
+	s := &fakeTagSender{}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
+	xs.AddTags("foo:bar")
+
+	xs.GaugeT("bar", 1, Tag{"baz", "1"})
+	assert.Equal(t, cmd{"GaugeT", "p.bar", 1, nil}, s.last)
+	assert.Equal(t, []Tag{{"baz", "1"}, {"foo", "bar"}}, s.pairs)
+	xs.CountT("bar", 2)
+	assert.Equal(t, cmd{"CountT", "p.bar", 2, nil}, s.last)
+	assert.Equal(t, []Tag{{"foo", "bar"}}, s.pairs)
+	xs.HistogramT("bar", 3)
+	assert.Equal(t, cmd{"HistogramT", "p.bar", 3, nil}, s.last)
+	xs.TimingT("bar", time.Second)
+	assert.Equal(t, cmd{"TimingT", "p.bar", 1, nil}, s.last)
+}
+
+func TestTagPairsString(t *testing.T) {
+	s := &fakeSender{}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
+	xs.AddTags("foo:bar")
+
+	xs.GaugeT("bar", 1, Tag{"baz", "1"})
+	assert.Equal(t, cmd{"Gauge", "p.bar", 1, []string{"baz:1", "foo:bar"}}, s.last)
+	xs.CountT("bar", 2)
+	assert.Equal(t, cmd{"Count", "p.bar", 2, []string{"foo:bar"}}, s.last)
+	xs.HistogramT("bar", 3, Tag{Key: "baz"})
+	assert.Equal(t, cmd{"Histogram", "p.bar", 3, []string{"baz", "foo:bar"}}, s.last)
+	xs.TimingT("bar", time.Second)
+	assert.Equal(t, cmd{"Timing", "p.bar", 1, []string{"foo:bar"}}, s.last)
+}
+
 func TestGauge(t *testing.T) {
 	s := &fakeSender{}
-	xs := &xstats{s: s, prefix: "p."}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
 	xs.AddTags("foo")
 	xs.Gauge("bar", 1, "baz")
 	assert.Equal(t, cmd{"Gauge", "p.bar", 1, []string{"baz", "foo"}}, s.last)
@@ -162,7 +363,7 @@ func TestGauge(t *testing.T) {
 
 func TestCount(t *testing.T) {
 	s := &fakeSender{}
-	xs := &xstats{s: s, prefix: "p."}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
 	xs.AddTags("foo")
 	xs.Count("bar", 1, "baz")
 	assert.Equal(t, cmd{"Count", "p.bar", 1, []string{"baz", "foo"}}, s.last)
@@ -170,7 +371,7 @@ func TestCount(t *testing.T) {
 
 func TestHistogram(t *testing.T) {
 	s := &fakeSender{}
-	xs := &xstats{s: s, prefix: "p."}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
 	xs.AddTags("foo")
 	xs.Histogram("bar", 1, "baz")
 	assert.Equal(t, cmd{"Histogram", "p.bar", 1, []string{"baz", "foo"}}, s.last)
@@ -178,16 +379,230 @@ func TestHistogram(t *testing.T) {
 
 func TestTiming(t *testing.T) {
 	s := &fakeSender{}
-	xs := &xstats{s: s, prefix: "p."}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
 	xs.AddTags("foo")
 	xs.Timing("bar", 1, "baz")
 	assert.Equal(t, cmd{"Timing", "p.bar", 1 / float64(time.Second), []string{"baz", "foo"}}, s.last)
 }
 
+func TestSet(t *testing.T) {
+	s := &fakeSetSender{}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
+	xs.AddTags("foo")
+	xs.Set("bar", "user1", "baz")
+	assert.Equal(t, cmd{"Set", "p.bar", 0, []string{"baz", "foo"}}, s.last)
+	assert.Equal(t, "user1", s.value)
+
+	// Ignored by senders without set support
+	xs = &xstats{state: &state{s: &fakeSender{}}}
+	xs.Set("bar", "user1")
+}
+
+func TestGaugeDelta(t *testing.T) {
+	s := &fakeGaugeDeltaSender{}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
+	xs.AddTags("foo")
+	xs.GaugeDelta("bar", -1, "baz")
+	assert.Equal(t, cmd{"GaugeDelta", "p.bar", -1, []string{"baz", "foo"}}, s.last)
+
+	// Ignored by senders without gauge delta support
+	s2 := &fakeSender{}
+	xs = &xstats{state: &state{s: s2}}
+	xs.GaugeDelta("bar", 1)
+	assert.Equal(t, cmd{}, s2.last)
+}
+
+func TestDistribution(t *testing.T) {
+	s := &fakeDistributionSender{}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
+	xs.AddTags("foo")
+	xs.Distribution("bar", 1, "baz")
+	assert.Equal(t, cmd{"Distribution", "p.bar", 1, []string{"baz", "foo"}}, s.last)
+
+	// Sent as histogram to senders without distribution support
+	fs := &fakeSender{}
+	xs = &xstats{state: &state{s: fs, prefix: "p."}}
+	xs.Distribution("bar", 1, "baz")
+	assert.Equal(t, cmd{"Histogram", "p.bar", 1, []string{"baz"}}, fs.last)
+}
+
+func TestEvent(t *testing.T) {
+	s := &fakeEventSender{}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
+	xs.AddTags("foo")
+	tags := make([]string, 1, 2)
+	tags[0] = "baz"
+
+	xs.Event(Event{Title: "bar", Tags: tags})
+	assert.Equal(t, Event{Title: "bar", Tags: []string{"baz", "foo"}}, s.event)
+	xs.ServiceCheck(ServiceCheck{Name: "bar", Status: StatusWarning, Tags: tags})
+	assert.Equal(t, ServiceCheck{Name: "p.bar", Status: StatusWarning, Tags: []string{"baz", "foo"}}, s.serviceCheck)
+	// The caller's tags are not modified
+	assert.Equal(t, []string{"baz"}, tags)
+	assert.Equal(t, "baz", tags[:2][0])
+	assert.Equal(t, "", tags[:2][1])
+
+	// Ignored by senders without event support
+	xs = &xstats{state: &state{s: &fakeSender{}}}
+	xs.Event(Event{Title: "bar"})
+	xs.ServiceCheck(ServiceCheck{Name: "bar"})
+}
+
+func TestSampled(t *testing.T) {
+	random = func() float64 { return 0.3 }
+	defer func() { random = rand.Float64 }()
+
+	s := &fakeSampledSender{}
+	xs := &xstats{state: &state{s: s, prefix: "p."}}
+	xs.AddTags("foo")
+
+	xs.CountSampled("bar", 1, 0.2, "baz")
+	assert.Equal(t, cmd{}, s.last)
+
+	xs.CountSampled("bar", 1, 0.5, "baz")
+	assert.Equal(t, cmd{"CountSampled", "p.bar", 1, []string{"baz", "foo"}}, s.last)
+	assert.Equal(t, 0.5, s.rate)
+
+	xs.HistogramSampled("bar", 2, 0.5, "baz")
+	assert.Equal(t, cmd{"HistogramSampled", "p.bar", 2, []string{"baz", "foo"}}, s.last)
+
+	xs.TimingSampled("bar", time.Second, 0.5, "baz")
+	assert.Equal(t, cmd{"TimingSampled", "p.bar", 1, []string{"baz", "foo"}}, s.last)
+
+	xs.CountSampled("bar", 1, 1, "baz")
+	assert.Equal(t, cmd{"Count", "p.bar", 1, []string{"baz", "foo"}}, s.last)
+
+	s.last = cmd{}
+	xs.CountSampled("bar", 1, 0, "baz")
+	assert.Equal(t, cmd{}, s.last)
+}
+
+// countingSender counts the observations it receives
+type countingSender struct {
+	fakeSender
+	n int
+}
+
+func (s *countingSender) Histogram(stat string, value float64, tags ...string) {
+	s.fakeSender.Histogram(stat, value, tags...)
+	s.n++
+}
+
+// syncSender counts the observations it receives from several goroutines
+type syncSender struct {
+	n int64
+}
+
+func (s *syncSender) Gauge(stat string, value float64, tags ...string) {
+	atomic.AddInt64(&s.n, 1)
+}
+
+func (s *syncSender) Count(stat string, count float64, tags ...string) {
+	atomic.AddInt64(&s.n, 1)
+}
+
+func (s *syncSender) Histogram(stat string, value float64, tags ...string) {
+	atomic.AddInt64(&s.n, 1)
+}
+
+func (s *syncSender) Timing(stat string, duration time.Duration, tags ...string) {
+	atomic.AddInt64(&s.n, 1)
+}
+
+func TestConcurrentTags(t *testing.T) {
+	s := &syncSender{}
+	xs := New(s)
+	xs.AddTags("env:prod")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				xs.SetTag("route", strconv.Itoa(j))
+				xs.AddTagPairs(Tag{Key: "foo"})
+				xs.RemoveTags("foo")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				xs.Count("bar", 1, "route:a")
+				xs.GaugeT("bar", 1)
+				xs.Event(Event{Title: "a"})
+				_ = xs.GetTags()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				xs2 := Copy(xs)
+				xs2.AddTags("copy:1")
+				xs3 := Scope(xs2, "scope")
+				xs3.Histogram("bar", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(4*300), atomic.LoadInt64(&s.n))
+	assert.Equal(t, "env:prod", xs.GetTags()[0])
+	assert.NotContains(t, xs.GetTags(), "copy:1")
+}
+
+func TestCopyIndependentTags(t *testing.T) {
+	xs := New(&fakeSender{})
+	xs.AddTags("a:1", "b:2")
+	xs2 := Copy(xs)
+	xs3 := Scope(xs, "s")
+
+	xs2.AddTags("c:3")
+	xs3.SetTag("a", "3")
+	xs.RemoveTags("b")
+
+	assert.Equal(t, []string{"a:1"}, xs.GetTags())
+	assert.Equal(t, []string{"a:1", "b:2", "c:3"}, xs2.GetTags())
+	assert.Equal(t, []string{"a:3", "b:2"}, xs3.GetTags())
+}
+
+func TestSampledScaled(t *testing.T) {
+	random = func() float64 { return 0 }
+	defer func() { random = rand.Float64 }()
+
+	s := &countingSender{}
+	xs := &xstats{state: &state{s: s}}
+
+	xs.CountSampled("bar", 2, 0.1)
+	assert.Equal(t, cmd{"Count", "bar", 20, nil}, s.last)
+
+	xs.HistogramSampled("bar", 2, 0.25)
+	assert.Equal(t, cmd{"Histogram", "bar", 2, nil}, s.last)
+	assert.Equal(t, 4, s.n)
+}
+
 func TestNilSender(t *testing.T) {
-	xs := &xstats{}
+	xs := &xstats{state: &state{}}
 	xs.Gauge("foo", 1)
 	xs.Count("foo", 1)
 	xs.Histogram("foo", 1)
 	xs.Timing("foo", 1)
+	xs.CountSampled("foo", 1, 0.5)
+	xs.HistogramSampled("foo", 1, 0.5)
+	xs.TimingSampled("foo", 1, 0.5)
+	xs.Set("foo", "bar")
+	xs.Distribution("foo", 1)
+	xs.Event(Event{})
+	xs.ServiceCheck(ServiceCheck{})
+}
+
+func BenchmarkCount(b *testing.B) {
+	xs := New(&fakeSender{})
+	xs.AddTags("env:prod", "role:api")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		xs.Count("metric1", 1)
+	}
 }